@@ -1,21 +1,72 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/alexedwards/argon2id"
+	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	hashParamsMu sync.RWMutex
+	hashParams   = argon2id.DefaultParams
+)
+
+// SetHashParams changes the cost of new hashes, existing ones are upgraded on login
+// when NeedsRehash reports them as weaker.
+func SetHashParams(params *argon2id.Params) {
+	hashParamsMu.Lock()
+	defer hashParamsMu.Unlock()
+	hashParams = params
+}
+
+func currentHashParams() *argon2id.Params {
+	hashParamsMu.RLock()
+	defer hashParamsMu.RUnlock()
+	return hashParams
+}
+
 func HashPassword(passwd string) (string, error) {
-	return argon2id.CreateHash(passwd, argon2id.DefaultParams)
+	return argon2id.CreateHash(passwd, currentHashParams())
+}
+
+// isBcryptHash detects hashes imported from the previous system.
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
 }
 
 func CheckPasswordHash(passwd, hash string) (bool, error) {
+	if isBcryptHash(hash) {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(passwd))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	}
 	return argon2id.ComparePasswordAndHash(passwd, hash)
 }
 
+// NeedsRehash reports hashes weaker than the current parameters and every legacy hash.
+// Parallelism is ignored since it follows the cpu count of whoever created the hash.
+func NeedsRehash(hash string) bool {
+	if isBcryptHash(hash) {
+		return true
+	}
+	params, _, _, err := argon2id.DecodeHash(hash)
+	if err != nil {
+		return false
+	}
+	current := currentHashParams()
+	return params.Memory < current.Memory ||
+		params.Iterations < current.Iterations ||
+		params.SaltLength < current.SaltLength ||
+		params.KeyLength < current.KeyLength
+}
+
 const authorizationBearerPrefix = "bearer"
 const authorizationApiKeyPrefix = "apikey"
 const authorizationHeaderName = "authorization"
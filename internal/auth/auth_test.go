@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/alexedwards/argon2id"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const passwordValid = "losPollosHermanos"
+
+var weakHashParams = &argon2id.Params{
+	Memory:      16 * 1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestCheckPasswordHash(t *testing.T) {
+	argonHash, err := HashPassword(passwordValid)
+	if err != nil {
+		t.Fatal("Failed hashing password (improper test case setup)")
+	}
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte(passwordValid), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal("Failed hashing password (improper test case setup)")
+	}
+	testCases := map[string]struct {
+		password string
+		hash     string
+		matches  bool
+	}{
+		"argon2id":          {password: passwordValid, hash: argonHash, matches: true},
+		"argon2id mismatch": {password: "sayMyName", hash: argonHash, matches: false},
+		"bcrypt":            {password: passwordValid, hash: string(bcryptHash), matches: true},
+		"bcrypt mismatch":   {password: "sayMyName", hash: string(bcryptHash), matches: false},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			matches, err := CheckPasswordHash(test.password, test.hash)
+			if err != nil {
+				t.Fatalf("Failed with error %#v", err)
+			}
+			if matches != test.matches {
+				t.Fatalf("Unexpected match result %v for payload %#v", matches, test)
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	weakHash, err := argon2id.CreateHash(passwordValid, weakHashParams)
+	if err != nil {
+		t.Fatal("Failed hashing password (improper test case setup)")
+	}
+	currentHash, err := HashPassword(passwordValid)
+	if err != nil {
+		t.Fatal("Failed hashing password (improper test case setup)")
+	}
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte(passwordValid), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal("Failed hashing password (improper test case setup)")
+	}
+	testCases := map[string]struct {
+		hash   string
+		rehash bool
+	}{
+		"weaker params":  {hash: weakHash, rehash: true},
+		"current params": {hash: currentHash, rehash: false},
+		"legacy bcrypt":  {hash: string(bcryptHash), rehash: true},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if rehash := NeedsRehash(test.hash); rehash != test.rehash {
+				t.Fatalf("Unexpected rehash result %v for payload %#v", rehash, test)
+			}
+		})
+	}
+}
@@ -2,53 +2,27 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
-	"fmt"
 	"net/http"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
 const issuer = "chirpy"
 
-func MakeJWT(userID uuid.UUID, secret string, validFor time.Duration) (string, error) {
-	claims := jwt.RegisteredClaims{
-		Issuer:    issuer,
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(validFor)),
-		Subject:   userID.String(),
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	jwt, err := token.SignedString([]byte(secret))
-	return jwt, err
+func MakeJWT(userID uuid.UUID, role Role, secret string, validFor time.Duration) (string, error) {
+	return NewHMACKeySet(secret).MakeJWT(userID, role, validFor)
 }
 
 func ValidateJWT(jwtString, secret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(jwtString, &jwt.RegisteredClaims{}, func(_ *jwt.Token) (any, error) {
-		return []byte(secret), nil
-	})
-	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("Failed token parsing %v", err)
-	}
-	sub, err := token.Claims.GetSubject()
-	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("Failed getting sub claim %v", err)
-	}
-	id, err := uuid.Parse(sub)
-	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("Failed uuid parsing %v", err)
-	}
-	return id, nil
+	return NewHMACKeySet(secret).ValidateJWT(jwtString)
 }
 
 func ValidateJWTFromHeader(h http.Header, secret string) (uuid.UUID, error) {
-	if tokenString, err := GetBearerToken(h); err != nil {
-		return uuid.UUID{}, err
-	} else {
-		return ValidateJWT(tokenString, secret)
-	}
+	return NewHMACKeySet(secret).ValidateJWTFromHeader(h)
 }
 
 func MakeRefreshToken() string {
@@ -56,3 +30,14 @@ func MakeRefreshToken() string {
 	rand.Read(randBytes)
 	return hex.EncodeToString(randBytes)
 }
+
+// HashToken is used to store single-use tokens, they are random enough not to need a salt.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckTokenHash compares in constant time, for secrets that are looked up by another key.
+func CheckTokenHash(token, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(hash)) == 1
+}
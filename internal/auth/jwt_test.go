@@ -101,7 +101,7 @@ func TestJWTSignature(t *testing.T) {
 
 	for name, test := range testCases {
 		t.Run(name, func(t *testing.T) {
-			_, err := MakeJWT(test.id, test.secret, test.validFor)
+			_, err := MakeJWT(test.id, RoleUser, test.secret, test.validFor)
 			if err != nil && test.valid {
 				t.Fatalf("Failed with error %#v", err)
 			}
@@ -141,7 +141,7 @@ func TestJWTValidation(t *testing.T) {
 
 	for name, test := range testCases {
 		t.Run(name, func(t *testing.T) {
-			jwtStr, err := MakeJWT(test.id, test.secret, test.validFor)
+			jwtStr, err := MakeJWT(test.id, RoleUser, test.secret, test.validFor)
 			if err != nil {
 				t.Fatal("Failed due to make jwt (impropet test case setup)")
 			}
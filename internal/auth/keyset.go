@@ -0,0 +1,371 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const keyFileExtension = ".pem"
+
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private any
+	public  any
+}
+
+// KeySet signs tokens with its current key and validates them against every key it knows,
+// so keys can be rotated by adding a new file and reloading.
+type KeySet struct {
+	mu      sync.RWMutex
+	dir     string
+	current *signingKey
+	keys    map[string]*signingKey
+}
+
+// NewHMACKeySet keeps the historical HS256 behaviour, it never publishes its secret.
+func NewHMACKeySet(secret string) *KeySet {
+	key := &signingKey{
+		method:  jwt.SigningMethodHS256,
+		private: []byte(secret),
+		public:  []byte(secret),
+	}
+	return &KeySet{current: key, keys: map[string]*signingKey{"": key}}
+}
+
+// LoadKeySet reads every PEM file in dir, the key id is the file name without extension.
+// Private keys sign and verify, public keys only verify. The private key with the greatest
+// id is used for signing, so naming files by date makes the newest key current.
+func LoadKeySet(dir string) (*KeySet, error) {
+	ks := &KeySet{dir: dir}
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Reload re-reads the key directory, tokens keep being served with the old keys on failure.
+func (ks *KeySet) Reload() error {
+	if ks.dir == "" {
+		return nil
+	}
+	paths, err := filepath.Glob(filepath.Join(ks.dir, "*"+keyFileExtension))
+	if err != nil {
+		return err
+	}
+	slices.Sort(paths)
+	var current *signingKey
+	keys := map[string]*signingKey{}
+	for _, path := range paths {
+		key, err := readSigningKey(path)
+		if err != nil {
+			return err
+		}
+		keys[key.id] = key
+		if key.private != nil {
+			current = key
+		}
+	}
+	if current == nil {
+		return fmt.Errorf("No private key found in %s", ks.dir)
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.current = current
+	ks.keys = keys
+	return nil
+}
+
+func readSigningKey(path string) (*signingKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("No PEM block in %s", path)
+	}
+	key := &signingKey{id: strings.TrimSuffix(filepath.Base(path), keyFileExtension)}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key.private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key.private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key.public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("Unsupported PEM block %s in %s", block.Type, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed parsing %s %v", path, err)
+	}
+	if signer, ok := key.private.(crypto.Signer); ok {
+		key.public = signer.Public()
+	}
+	switch key.public.(type) {
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	case *rsa.PublicKey:
+		key.method = jwt.SigningMethodRS256
+	default:
+		return nil, fmt.Errorf("Unsupported key type %T in %s", key.public, path)
+	}
+	return key, nil
+}
+
+// mfaAudience marks tokens that only prove the password step of a two-factor login.
+const mfaAudience = "chirpy-mfa"
+
+// downloadAudience marks tokens embedded in signed download urls, their subject is the
+// downloadable resource instead of a user.
+const downloadAudience = "chirpy-download"
+
+type claims struct {
+	jwt.RegisteredClaims
+	Role Role `json:"role,omitempty"`
+	// ClientID and Scope are only set on tokens issued to OAuth clients (RFC 9068).
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+func newClaims(userID uuid.UUID, validFor time.Duration) claims {
+	return claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(validFor)),
+			Subject:   userID.String(),
+		},
+	}
+}
+
+func (ks *KeySet) sign(c jwt.Claims) (string, error) {
+	ks.mu.RLock()
+	key := ks.current
+	ks.mu.RUnlock()
+	token := jwt.NewWithClaims(key.method, c)
+	if key.id != "" {
+		token.Header["kid"] = key.id
+	}
+	return token.SignedString(key.private)
+}
+
+func (ks *KeySet) MakeJWT(userID uuid.UUID, role Role, validFor time.Duration) (string, error) {
+	c := newClaims(userID, validFor)
+	c.Role = role
+	return ks.sign(c)
+}
+
+// MakeOAuthAccessToken issues a token limited to scopes, it never carries a role.
+func (ks *KeySet) MakeOAuthAccessToken(userID uuid.UUID, clientID string, scopes []Scope, validFor time.Duration) (string, error) {
+	c := newClaims(userID, validFor)
+	c.ClientID = clientID
+	c.Scope = FormatScopes(scopes)
+	return ks.sign(c)
+}
+
+// IDToken holds the OpenID Connect claims, Email is left out when empty.
+type IDToken struct {
+	Issuer        string
+	ClientID      string
+	UserID        uuid.UUID
+	Nonce         string
+	Email         string
+	EmailVerified bool
+}
+
+// MakeIDToken is meant for the client only, its audience keeps it from being accepted
+// as an access token. Clients can only verify it when the key set is asymmetric.
+func (ks *KeySet) MakeIDToken(t IDToken, validFor time.Duration) (string, error) {
+	c := idTokenClaims{
+		RegisteredClaims: newClaims(t.UserID, validFor).RegisteredClaims,
+		Nonce:            t.Nonce,
+	}
+	c.Issuer = t.Issuer
+	c.Audience = jwt.ClaimStrings{t.ClientID}
+	if t.Email != "" {
+		c.Email = t.Email
+		c.EmailVerified = &t.EmailVerified
+	}
+	return ks.sign(c)
+}
+
+// SigningAlgorithm is the alg of the key currently used to sign tokens.
+func (ks *KeySet) SigningAlgorithm() string {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.current.method.Alg()
+}
+
+func (ks *KeySet) MakeMFAToken(userID uuid.UUID, validFor time.Duration) (string, error) {
+	c := newClaims(userID, validFor)
+	c.Audience = jwt.ClaimStrings{mfaAudience}
+	return ks.sign(c)
+}
+
+func (ks *KeySet) MakeDownloadToken(resourceID uuid.UUID, validFor time.Duration) (string, error) {
+	c := newClaims(resourceID, validFor)
+	c.Audience = jwt.ClaimStrings{downloadAudience}
+	return ks.sign(c)
+}
+
+func (ks *KeySet) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	ks.mu.RLock()
+	key, ok := ks.keys[kid]
+	ks.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("Unexpected signing method %s for key %q", token.Method.Alg(), kid)
+	}
+	return key.public, nil
+}
+
+func (ks *KeySet) parseSubject(jwtString string, opts ...jwt.ParserOption) (uuid.UUID, *claims, error) {
+	c := &claims{}
+	token, err := jwt.ParseWithClaims(jwtString, c, ks.keyFunc, opts...)
+	if err != nil {
+		return uuid.UUID{}, nil, fmt.Errorf("Failed token parsing %v", err)
+	}
+	sub, err := token.Claims.GetSubject()
+	if err != nil {
+		return uuid.UUID{}, nil, fmt.Errorf("Failed getting sub claim %v", err)
+	}
+	id, err := uuid.Parse(sub)
+	if err != nil {
+		return uuid.UUID{}, nil, fmt.Errorf("Failed uuid parsing %v", err)
+	}
+	return id, c, nil
+}
+
+// AccessToken is what a validated access token grants, Scopes is nil for first party
+// tokens which are not restricted.
+type AccessToken struct {
+	UserID   uuid.UUID
+	Role     Role
+	ClientID string
+	Scopes   []Scope
+}
+
+func (t AccessToken) Allows(scope Scope) bool {
+	return t.ClientID == "" || slices.Contains(t.Scopes, scope)
+}
+
+// ValidateAccessToken only accepts access tokens, tokens issued for a specific audience
+// are refused. Tokens issued before roles existed belong to regular users.
+func (ks *KeySet) ValidateAccessToken(jwtString string) (AccessToken, error) {
+	id, c, err := ks.parseSubject(jwtString)
+	if err != nil {
+		return AccessToken{}, err
+	}
+	if len(c.Audience) > 0 {
+		return AccessToken{}, fmt.Errorf("Unexpected token audience %v", c.Audience)
+	}
+	token := AccessToken{UserID: id, Role: c.Role, ClientID: c.ClientID}
+	if token.Role == "" {
+		token.Role = RoleUser
+	}
+	if token.ClientID != "" {
+		token.Role = RoleUser
+		for _, scope := range strings.Fields(c.Scope) {
+			token.Scopes = append(token.Scopes, Scope(scope))
+		}
+	}
+	return token, nil
+}
+
+func (ks *KeySet) ValidateJWTWithRole(jwtString string) (uuid.UUID, Role, error) {
+	token, err := ks.ValidateAccessToken(jwtString)
+	if err != nil {
+		return uuid.UUID{}, "", err
+	}
+	return token.UserID, token.Role, nil
+}
+
+func (ks *KeySet) ValidateJWT(jwtString string) (uuid.UUID, error) {
+	id, _, err := ks.ValidateJWTWithRole(jwtString)
+	return id, err
+}
+
+func (ks *KeySet) ValidateMFAToken(jwtString string) (uuid.UUID, error) {
+	id, _, err := ks.parseSubject(jwtString, jwt.WithAudience(mfaAudience))
+	return id, err
+}
+
+func (ks *KeySet) ValidateDownloadToken(jwtString string) (uuid.UUID, error) {
+	id, _, err := ks.parseSubject(jwtString, jwt.WithAudience(downloadAudience))
+	return id, err
+}
+
+func (ks *KeySet) ValidateJWTFromHeader(h http.Header) (uuid.UUID, error) {
+	if tokenString, err := GetBearerToken(h); err != nil {
+		return uuid.UUID{}, err
+	} else {
+		return ks.ValidateJWT(tokenString)
+	}
+}
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public half of every asymmetric key, symmetric keys are never exposed.
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		jwk := JWK{KeyID: key.id, Algorithm: key.method.Alg(), Use: "sig"}
+		switch pub := key.public.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	slices.SortFunc(jwks.Keys, func(a, b JWK) int { return strings.Compare(a.KeyID, b.KeyID) })
+	return jwks
+}
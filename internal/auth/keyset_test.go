@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func writeTestPEM(t *testing.T, dir, name, blockType string, der []byte) {
+	t.Helper()
+	raw := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name+keyFileExtension), raw, 0o600); err != nil {
+		t.Fatal("Failed writing key (improper test case setup)")
+	}
+}
+
+func writeTestEd25519Key(t *testing.T, dir, name string) ed25519.PublicKey {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal("Failed generating key (improper test case setup)")
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal("Failed marshalling key (improper test case setup)")
+	}
+	writeTestPEM(t, dir, name, "PRIVATE KEY", der)
+	return pub
+}
+
+func writeTestRSAKey(t *testing.T, dir, name string) {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("Failed generating key (improper test case setup)")
+	}
+	writeTestPEM(t, dir, name, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(priv))
+}
+
+func tokenKeyID(t *testing.T, tokenString string) string {
+	t.Helper()
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatalf("Failed parsing token %v", err)
+	}
+	kid, _ := token.Header["kid"].(string)
+	return kid
+}
+
+func TestKeySetSignature(t *testing.T) {
+	testCases := map[string]struct {
+		writeKey func(t *testing.T, dir, name string)
+		alg      string
+		kty      string
+	}{
+		"ed25519": {
+			writeKey: func(t *testing.T, dir, name string) { writeTestEd25519Key(t, dir, name) },
+			alg:      "EdDSA",
+			kty:      "OKP",
+		},
+		"rsa": {
+			writeKey: writeTestRSAKey,
+			alg:      "RS256",
+			kty:      "RSA",
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			test.writeKey(t, dir, "2026-01-01")
+			ks, err := LoadKeySet(dir)
+			if err != nil {
+				t.Fatalf("Failed loading key set %v", err)
+			}
+			id := uuid.New()
+			jwtStr, err := ks.MakeJWT(id, RoleUser, time.Hour)
+			if err != nil {
+				t.Fatalf("Failed with error %#v", err)
+			}
+			if kid := tokenKeyID(t, jwtStr); kid != "2026-01-01" {
+				t.Fatalf("Unexpected kid %q", kid)
+			}
+			uid, err := ks.ValidateJWT(jwtStr)
+			if err != nil {
+				t.Fatalf("Validation failed with error %v", err)
+			}
+			if uid != id {
+				t.Fatalf(ErrorIDValidation, id, uid)
+			}
+			jwks := ks.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].Algorithm != test.alg || jwks.Keys[0].KeyType != test.kty {
+				t.Fatalf("Unexpected jwks %#v", jwks)
+			}
+		})
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeTestEd25519Key(t, dir, "2026-01-01")
+	ks, err := LoadKeySet(dir)
+	if err != nil {
+		t.Fatalf("Failed loading key set %v", err)
+	}
+	oldToken, err := ks.MakeJWT(uuid.New(), RoleUser, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed with error %#v", err)
+	}
+
+	writeTestRSAKey(t, dir, "2026-02-01")
+	if err := ks.Reload(); err != nil {
+		t.Fatalf("Failed reloading key set %v", err)
+	}
+	newToken, err := ks.MakeJWT(uuid.New(), RoleUser, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed with error %#v", err)
+	}
+	if kid := tokenKeyID(t, newToken); kid != "2026-02-01" {
+		t.Fatalf("Reload did not switch to the newest key, got kid %q", kid)
+	}
+	if _, err := ks.ValidateJWT(oldToken); err != nil {
+		t.Fatalf("Token signed with the previous key should still validate %v", err)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "2026-01-01"+keyFileExtension)); err != nil {
+		t.Fatal("Failed removing key (improper test case setup)")
+	}
+	if err := ks.Reload(); err != nil {
+		t.Fatalf("Failed reloading key set %v", err)
+	}
+	if _, err := ks.ValidateJWT(oldToken); err == nil {
+		t.Fatalf("Token signed with a retired key should not validate")
+	}
+}
+
+func TestKeySetRejectsHMAC(t *testing.T) {
+	dir := t.TempDir()
+	pub := writeTestEd25519Key(t, dir, "2026-01-01")
+	ks, err := LoadKeySet(dir)
+	if err != nil {
+		t.Fatalf("Failed loading key set %v", err)
+	}
+	// Algorithm confusion: an HS256 token keyed with the public key must be refused.
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: uuid.New().String()})
+	token.Header["kid"] = "2026-01-01"
+	forged, err := token.SignedString([]byte(pub))
+	if err != nil {
+		t.Fatal("Failed forging token (improper test case setup)")
+	}
+	if _, err := ks.ValidateJWT(forged); err == nil {
+		t.Fatalf("Expected failure for forged token")
+	}
+	hmacToken, err := MakeJWT(uuid.New(), RoleUser, secretValid, time.Hour)
+	if err != nil {
+		t.Fatal("Failed due to make jwt (improper test case setup)")
+	}
+	if _, err := ks.ValidateJWT(hmacToken); err == nil {
+		t.Fatalf("Expected failure for token without kid")
+	}
+}
+
+func TestMFAToken(t *testing.T) {
+	ks := NewHMACKeySet(secretValid)
+	id := uuid.New()
+	mfaToken, err := ks.MakeMFAToken(id, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed with error %#v", err)
+	}
+	if _, err := ks.ValidateJWT(mfaToken); err == nil {
+		t.Fatalf("MFA token should not be accepted as an access token")
+	}
+	uid, err := ks.ValidateMFAToken(mfaToken)
+	if err != nil {
+		t.Fatalf("Validation failed with error %v", err)
+	}
+	if uid != id {
+		t.Fatalf(ErrorIDValidation, id, uid)
+	}
+	accessToken, err := ks.MakeJWT(id, RoleUser, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed with error %#v", err)
+	}
+	if _, err := ks.ValidateMFAToken(accessToken); err == nil {
+		t.Fatalf("Access token should not be accepted as an MFA token")
+	}
+}
+
+func TestDownloadToken(t *testing.T) {
+	ks := NewHMACKeySet(secretValid)
+	id := uuid.New()
+	downloadToken, err := ks.MakeDownloadToken(id, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed with error %#v", err)
+	}
+	if _, err := ks.ValidateJWT(downloadToken); err == nil {
+		t.Fatalf("Download token should not be accepted as an access token")
+	}
+	if _, err := ks.ValidateMFAToken(downloadToken); err == nil {
+		t.Fatalf("Download token should not be accepted as an MFA token")
+	}
+	resourceID, err := ks.ValidateDownloadToken(downloadToken)
+	if err != nil {
+		t.Fatalf("Validation failed with error %v", err)
+	}
+	if resourceID != id {
+		t.Fatalf(ErrorIDValidation, id, resourceID)
+	}
+	expired, err := ks.MakeDownloadToken(id, -time.Minute)
+	if err != nil {
+		t.Fatalf("Failed with error %#v", err)
+	}
+	if _, err := ks.ValidateDownloadToken(expired); err == nil {
+		t.Fatalf("Expired download token should be refused")
+	}
+}
+
+func TestOAuthAccessToken(t *testing.T) {
+	ks := NewHMACKeySet(secretValid)
+	id := uuid.New()
+	oauthToken, err := ks.MakeOAuthAccessToken(id, "partner-app", []Scope{ScopeChirpsRead, ScopeOpenID}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed with error %#v", err)
+	}
+	token, err := ks.ValidateAccessToken(oauthToken)
+	if err != nil {
+		t.Fatalf("Validation failed with error %v", err)
+	}
+	if token.UserID != id {
+		t.Fatalf(ErrorIDValidation, id, token.UserID)
+	}
+	if !token.Allows(ScopeChirpsRead) || token.Allows(ScopeChirpsWrite) || token.Allows(ScopeSession) {
+		t.Fatalf("Invalid scopes %v", token.Scopes)
+	}
+	if token.Role != RoleUser {
+		t.Fatalf("OAuth token should not carry a role, got %s", token.Role)
+	}
+	firstParty, err := ks.MakeJWT(id, RoleAdmin, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed with error %#v", err)
+	}
+	if token, err := ks.ValidateAccessToken(firstParty); err != nil || !token.Allows(ScopeSession) {
+		t.Fatalf("First party token should allow every scope %v", err)
+	}
+}
+
+func TestIDToken(t *testing.T) {
+	ks := NewHMACKeySet(secretValid)
+	idToken, err := ks.MakeIDToken(IDToken{
+		Issuer:   "http://localhost:8080",
+		ClientID: "partner-app",
+		UserID:   uuid.New(),
+		Nonce:    "n-0S6_WzA2Mj",
+		Email:    "saul@bettercall.com",
+	}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed with error %#v", err)
+	}
+	if _, err := ks.ValidateAccessToken(idToken); err == nil {
+		t.Fatalf("ID token should not be accepted as an access token")
+	}
+	c := &idTokenClaims{}
+	if _, err := jwt.ParseWithClaims(idToken, c, ks.keyFunc, jwt.WithAudience("partner-app"), jwt.WithIssuer("http://localhost:8080")); err != nil {
+		t.Fatalf("Validation failed with error %v", err)
+	}
+	if c.Nonce != "n-0S6_WzA2Mj" || c.Email != "saul@bettercall.com" || c.EmailVerified == nil || *c.EmailVerified {
+		t.Fatalf("Invalid claims %#v", c)
+	}
+}
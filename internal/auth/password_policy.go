@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type PasswordRule string
+
+const (
+	PasswordRuleMinLength     PasswordRule = "min_length"
+	PasswordRuleEntropy       PasswordRule = "entropy"
+	PasswordRuleContainsEmail PasswordRule = "contains_email"
+	PasswordRuleBreached      PasswordRule = "breached"
+)
+
+type PasswordViolation struct {
+	Rule    PasswordRule `json:"rule"`
+	Message string       `json:"message"`
+}
+
+// PasswordPolicyError lists every rule the password failed so they can all be fixed at once.
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "Password does not meet the password policy"
+}
+
+// BreachedPasswordChecker reports passwords known from public breaches.
+type BreachedPasswordChecker interface {
+	Contains(password string) bool
+}
+
+// PasswordPolicy zero values disable their rule, Breached may be nil.
+type PasswordPolicy struct {
+	MinLength int
+	// MinEntropy is in bits as computed by EstimatePasswordEntropy.
+	MinEntropy float64
+	Breached   BreachedPasswordChecker
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:  8,
+	MinEntropy: 36,
+}
+
+// Check returns a *PasswordPolicyError when the password breaks any rule.
+func (p PasswordPolicy) Check(password, email string) error {
+	violations := []PasswordViolation{}
+	if length := utf8.RuneCountInString(password); length < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Rule:    PasswordRuleMinLength,
+			Message: fmt.Sprintf("Password must be at least %d characters long", p.MinLength),
+		})
+	}
+	if p.MinEntropy > 0 && EstimatePasswordEntropy(password) < p.MinEntropy {
+		violations = append(violations, PasswordViolation{
+			Rule:    PasswordRuleEntropy,
+			Message: "Password is too easy to guess, avoid repeated characters and sequences",
+		})
+	}
+	if containsEmail(password, email) {
+		violations = append(violations, PasswordViolation{
+			Rule:    PasswordRuleContainsEmail,
+			Message: "Password must not contain your email address",
+		})
+	}
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violations = append(violations, PasswordViolation{
+			Rule:    PasswordRuleBreached,
+			Message: "Password appeared in a data breach, choose another one",
+		})
+	}
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// containsEmail also catches the local part alone, it is what people usually reuse.
+func containsEmail(password, email string) bool {
+	if email == "" {
+		return false
+	}
+	password = strings.ToLower(password)
+	email = strings.ToLower(email)
+	if strings.Contains(password, email) {
+		return true
+	}
+	local, _, _ := strings.Cut(email, "@")
+	return len(local) >= 3 && strings.Contains(password, local)
+}
+
+func passwordCharsetSize(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	size := 0.0
+	for _, class := range []struct {
+		present bool
+		size    float64
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			size += class.size
+		}
+	}
+	return size
+}
+
+// EstimatePasswordEntropy is a simplified take on zxcvbn: every character is worth the
+// size of the character classes in use, except repeats and ascending or descending
+// sequences which a cracker tries first and are only worth a single bit.
+// Dictionary words are left to the breached password list.
+func EstimatePasswordEntropy(password string) float64 {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 0
+	}
+	perChar := math.Log2(passwordCharsetSize(password))
+	bits := 0.0
+	for i, r := range runes {
+		if i > 0 {
+			if delta := r - runes[i-1]; delta >= -1 && delta <= 1 {
+				bits++
+				continue
+			}
+		}
+		bits += perChar
+	}
+	return bits
+}
+
+const breachedPrefixLength = 5
+
+// BreachedPasswordList is indexed like the k-anonymity range API of Have I Been Pwned:
+// hashes are grouped by their first five hex characters so a lookup only scans one bucket.
+type BreachedPasswordList struct {
+	suffixesByPrefix map[string][]string
+}
+
+// LoadBreachedPasswordList reads one uppercase or lowercase SHA-1 hex digest per line,
+// optionally followed by ":count" as in the downloadable corpus. Blank lines and lines
+// starting with # are ignored.
+func LoadBreachedPasswordList(path string) (*BreachedPasswordList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	list := &BreachedPasswordList{suffixesByPrefix: map[string][]string{}}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		hash, _, _ := strings.Cut(entry, ":")
+		hash = strings.ToUpper(hash)
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("Invalid sha1 digest on line %d of %s", line, path)
+		}
+		prefix := hash[:breachedPrefixLength]
+		list.suffixesByPrefix[prefix] = append(list.suffixesByPrefix[prefix], hash[breachedPrefixLength:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, suffixes := range list.suffixesByPrefix {
+		slices.Sort(suffixes)
+	}
+	return list, nil
+}
+
+func (l *BreachedPasswordList) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	_, found := slices.BinarySearch(l.suffixesByPrefix[hash[:breachedPrefixLength]], hash[breachedPrefixLength:])
+	return found
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// SHA-1 of "password123" and "hunter22".
+const breachedCorpus = `# test corpus
+CBFDAC6008F9CAB4083784CBD1874F76618D2A97:2493390
+60b3af8bfe3735623c7d4a5ef749bb6ac1a4413a
+`
+
+func writeBreachedCorpus(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal("Failed writing corpus (improper test case setup)")
+	}
+	return path
+}
+
+func TestBreachedPasswordList(t *testing.T) {
+	list, err := LoadBreachedPasswordList(writeBreachedCorpus(t, breachedCorpus))
+	if err != nil {
+		t.Fatalf("Failed with error %#v", err)
+	}
+	testCases := map[string]struct {
+		password string
+		breached bool
+	}{
+		"with count":    {password: "password123", breached: true},
+		"lowercase":     {password: "hunter22", breached: true},
+		"not breached":  {password: "losPollosHermanos", breached: false},
+		"same password": {password: "Password123", breached: false},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if breached := list.Contains(test.password); breached != test.breached {
+				t.Fatalf("Unexpected result %v for %s", breached, test.password)
+			}
+		})
+	}
+}
+
+func TestLoadBreachedPasswordListInvalid(t *testing.T) {
+	if _, err := LoadBreachedPasswordList(writeBreachedCorpus(t, "password123\n")); err == nil {
+		t.Fatal("Plain passwords should be rejected")
+	}
+}
+
+func TestEstimatePasswordEntropy(t *testing.T) {
+	testCases := map[string]struct {
+		password string
+		min      float64
+		max      float64
+	}{
+		"empty":          {password: "", min: 0, max: 0},
+		"repeated":       {password: "aaaaaaaaaaaa", min: 0, max: 20},
+		"sequence":       {password: "12345678", min: 0, max: 15},
+		"reverse":        {password: "zyxwvuts", min: 0, max: 15},
+		"mixed classes":  {password: "Tr0ub4dor&3", min: 60, max: 80},
+		"long lowercase": {password: "correcthorsebatterystaple", min: 90, max: 120},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if bits := EstimatePasswordEntropy(test.password); bits < test.min || bits > test.max {
+				t.Fatalf("Entropy %.1f of %q outside of [%.0f, %.0f]", bits, test.password, test.min, test.max)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	list, err := LoadBreachedPasswordList(writeBreachedCorpus(t, breachedCorpus))
+	if err != nil {
+		t.Fatal("Failed loading corpus (improper test case setup)")
+	}
+	policy := DefaultPasswordPolicy
+	policy.Breached = list
+	testCases := map[string]struct {
+		password   string
+		violations []PasswordRule
+	}{
+		"strong password": {password: "losPollosHermanos", violations: nil},
+		"too short":       {password: "a", violations: []PasswordRule{PasswordRuleMinLength, PasswordRuleEntropy}},
+		"low entropy":     {password: "aaaaaaaaaaaa", violations: []PasswordRule{PasswordRuleEntropy}},
+		"contains email":  {password: "xX-saul@bettercall.com-Xx", violations: []PasswordRule{PasswordRuleContainsEmail}},
+		"contains local":  {password: "it's all good Saul!", violations: []PasswordRule{PasswordRuleContainsEmail}},
+		"breached":        {password: "password123", violations: []PasswordRule{PasswordRuleBreached}},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := policy.Check(test.password, "saul@bettercall.com")
+			if test.violations == nil {
+				if err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+				return
+			}
+			policyErr := &PasswordPolicyError{}
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("Expected a policy error, got %v", err)
+			}
+			rules := []PasswordRule{}
+			for _, violation := range policyErr.Violations {
+				rules = append(rules, violation.Rule)
+			}
+			if !slices.Equal(rules, test.violations) {
+				t.Fatalf("Invalid violations\nexpected: %v\ngot: %v", test.violations, rules)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package auth
+
+import "testing"
+
+// Values from RFC 7636 appendix B.
+const (
+	pkceVerifierValid  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	pkceChallengeValid = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	testCases := map[string]struct {
+		verifier  string
+		challenge string
+		valid     bool
+	}{
+		"base case":          {verifier: pkceVerifierValid, challenge: pkceChallengeValid, valid: true},
+		"wrong verifier":     {verifier: "xBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk", challenge: pkceChallengeValid, valid: false},
+		"plain challenge":    {verifier: pkceVerifierValid, challenge: pkceVerifierValid, valid: false},
+		"verifier too short": {verifier: "short", challenge: pkceChallengeValid, valid: false},
+		"invalid characters": {verifier: pkceVerifierValid + "!", challenge: pkceChallengeValid, valid: false},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if valid := VerifyPKCE(test.verifier, test.challenge); valid != test.valid {
+				t.Fatalf("Unexpected result %v for payload %#v", valid, test)
+			}
+		})
+	}
+}
+
+func TestIsValidPKCEChallenge(t *testing.T) {
+	if !IsValidPKCEChallenge(pkceChallengeValid) {
+		t.Fatalf("Challenge %s should be valid", pkceChallengeValid)
+	}
+	if IsValidPKCEChallenge(pkceVerifierValid + "xx") {
+		t.Fatal("Challenge must decode to a sha256 digest")
+	}
+}
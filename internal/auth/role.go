@@ -0,0 +1,34 @@
+package auth
+
+import "fmt"
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+var roleRanks = map[Role]int{
+	RoleUser:      0,
+	RoleModerator: 1,
+	RoleAdmin:     2,
+}
+
+func ParseRole(role string) (Role, error) {
+	if _, ok := roleRanks[Role(role)]; !ok {
+		return "", fmt.Errorf("Invalid role %q", role)
+	}
+	return Role(role), nil
+}
+
+// Satisfies reports whether r grants at least the permissions of required, admins can do
+// everything moderators can and moderators everything users can.
+func (r Role) Satisfies(required Role) bool {
+	rank, ok := roleRanks[r]
+	if !ok {
+		return false
+	}
+	return rank >= roleRanks[required]
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestRoleSatisfies(t *testing.T) {
+	testCases := map[string]struct {
+		role     Role
+		required Role
+		allowed  bool
+	}{
+		"user as user":       {role: RoleUser, required: RoleUser, allowed: true},
+		"user as admin":      {role: RoleUser, required: RoleAdmin, allowed: false},
+		"moderator as user":  {role: RoleModerator, required: RoleUser, allowed: true},
+		"moderator as admin": {role: RoleModerator, required: RoleAdmin, allowed: false},
+		"admin as moderator": {role: RoleAdmin, required: RoleModerator, allowed: true},
+		"unknown role":       {role: Role("root"), required: RoleUser, allowed: false},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if allowed := test.role.Satisfies(test.required); allowed != test.allowed {
+				t.Fatalf("Unexpected result %v for payload %#v", allowed, test)
+			}
+		})
+	}
+}
+
+func TestJWTRole(t *testing.T) {
+	ks := NewHMACKeySet(secretValid)
+	jwtStr, err := ks.MakeJWT(uuid.New(), RoleAdmin, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed with error %#v", err)
+	}
+	if _, role, err := ks.ValidateJWTWithRole(jwtStr); err != nil || role != RoleAdmin {
+		t.Fatalf("Role lost in validation\nexpected: %v\ngot: %v (%v)", RoleAdmin, role, err)
+	}
+
+	// Tokens issued before roles were added carry no role claim.
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    issuer,
+		Subject:   uuid.New().String(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	legacyStr, err := legacy.SignedString([]byte(secretValid))
+	if err != nil {
+		t.Fatal("Failed signing legacy token (improper test case setup)")
+	}
+	if _, role, err := ks.ValidateJWTWithRole(legacyStr); err != nil || role != RoleUser {
+		t.Fatalf("Legacy token should be a user token\ngot: %v (%v)", role, err)
+	}
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type Scope string
+
+const (
+	ScopeChirpsRead   Scope = "chirps:read"
+	ScopeChirpsWrite  Scope = "chirps:write"
+	ScopeProfileWrite Scope = "profile:write"
+	// ScopeSession is implied by interactive logins only and can never be granted to a
+	// personal access token, it guards account security routes.
+	ScopeSession Scope = "session"
+	// ScopeOpenID and ScopeEmail only make sense for OAuth clients, they unlock the
+	// id token and the userinfo claims.
+	ScopeOpenID Scope = "openid"
+	ScopeEmail  Scope = "email"
+)
+
+var (
+	grantableScopes = []Scope{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+	oauthScopes     = append([]Scope{ScopeOpenID, ScopeEmail}, grantableScopes...)
+)
+
+// ParseScopes rejects unknown and non grantable scopes, duplicates are dropped.
+func ParseScopes(scopes []string) ([]Scope, error) {
+	return parseScopes(scopes, grantableScopes)
+}
+
+// ParseOAuthScopes is ParseScopes for the space separated scope parameter of OAuth requests.
+func ParseOAuthScopes(scope string) ([]Scope, error) {
+	return parseScopes(strings.Fields(scope), oauthScopes)
+}
+
+func parseScopes(scopes []string, allowed []Scope) ([]Scope, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("At least one scope is required")
+	}
+	parsed := []Scope{}
+	for _, scope := range scopes {
+		if !slices.Contains(allowed, Scope(scope)) {
+			return nil, fmt.Errorf("Invalid scope %q", scope)
+		}
+		if !slices.Contains(parsed, Scope(scope)) {
+			parsed = append(parsed, Scope(scope))
+		}
+	}
+	return parsed, nil
+}
+
+// FormatScopes is the inverse of ParseOAuthScopes.
+func FormatScopes(scopes []Scope) string {
+	parts := make([]string, len(scopes))
+	for i, scope := range scopes {
+		parts[i] = string(scope)
+	}
+	return strings.Join(parts, " ")
+}
+
+const personalAccessTokenPrefix = "chirpy_pat_"
+
+// MakePersonalAccessToken is prefixed so it can be told apart from a JWT and spotted by secret scanners.
+func MakePersonalAccessToken() string {
+	randBytes := make([]byte, 32)
+	rand.Read(randBytes)
+	return personalAccessTokenPrefix + hex.EncodeToString(randBytes)
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, personalAccessTokenPrefix)
+}
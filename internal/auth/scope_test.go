@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestParseScopes(t *testing.T) {
+	testCases := map[string]struct {
+		scopes []string
+		valid  bool
+		parsed []Scope
+	}{
+		"base case": {
+			scopes: []string{"chirps:read", "chirps:write"},
+			valid:  true,
+			parsed: []Scope{ScopeChirpsRead, ScopeChirpsWrite},
+		},
+		"duplicates": {
+			scopes: []string{"profile:write", "profile:write"},
+			valid:  true,
+			parsed: []Scope{ScopeProfileWrite},
+		},
+		"unknown scope":   {scopes: []string{"chirps:delete"}, valid: false},
+		"session scope":   {scopes: []string{"session"}, valid: false},
+		"no scope at all": {scopes: []string{}, valid: false},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			parsed, err := ParseScopes(test.scopes)
+			if err != nil && test.valid {
+				t.Fatalf("Parsing failed for payload %#v", test.scopes)
+			}
+			if err == nil && !test.valid {
+				t.Fatalf("Expected failure for payload %#v", test.scopes)
+			}
+			if test.valid && !slices.Equal(parsed, test.parsed) {
+				t.Fatalf("Invalid scopes\nexpected: %v\ngot: %v", test.parsed, parsed)
+			}
+		})
+	}
+}
+
+func TestPersonalAccessToken(t *testing.T) {
+	token := MakePersonalAccessToken()
+	if !IsPersonalAccessToken(token) {
+		t.Fatalf("Token %s not recognized as a personal access token", token)
+	}
+	jwtStr, err := MakeJWT(uuid.New(), RoleUser, secretValid, 0)
+	if err != nil {
+		t.Fatal("Failed due to make jwt (improper test case setup)")
+	}
+	if IsPersonalAccessToken(jwtStr) {
+		t.Fatalf("JWT recognized as a personal access token")
+	}
+}
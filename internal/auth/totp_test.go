@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 seed "12345678901234567890" from RFC 6238 appendix B.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestMakeTOTPCode(t *testing.T) {
+	testCases := map[string]struct {
+		at   int64
+		code string
+	}{
+		"T=59":         {at: 59, code: "287082"},
+		"T=1111111109": {at: 1111111109, code: "081804"},
+		"T=1234567890": {at: 1234567890, code: "005924"},
+		"T=2000000000": {at: 2000000000, code: "279037"},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			code, err := MakeTOTPCode(rfc6238Secret, time.Unix(test.at, 0))
+			if err != nil {
+				t.Fatalf("Failed with error %#v", err)
+			}
+			if code != test.code {
+				t.Fatalf("Invalid code\nexpected: %s\ngot: %s", test.code, code)
+			}
+		})
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Now()
+	secret := GenerateTOTPSecret()
+	testCases := map[string]struct {
+		generatedAt time.Time
+		valid       bool
+	}{
+		"current step":  {generatedAt: now, valid: true},
+		"previous step": {generatedAt: now.Add(-totpPeriod * time.Second), valid: true},
+		"next step":     {generatedAt: now.Add(totpPeriod * time.Second), valid: true},
+		"too old":       {generatedAt: now.Add(-3 * totpPeriod * time.Second), valid: false},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			code, err := MakeTOTPCode(secret, test.generatedAt)
+			if err != nil {
+				t.Fatal("Failed due to make totp code (improper test case setup)")
+			}
+			step, ok := ValidateTOTP(secret, code, now)
+			if ok != test.valid {
+				t.Fatalf("Unexpected validation result %v for payload %#v", ok, test)
+			}
+			if ok && step != totpStep(test.generatedAt) {
+				t.Fatalf("Unexpected step\nexpected: %d\ngot: %d", totpStep(test.generatedAt), step)
+			}
+		})
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI(rfc6238Secret, "saul@bettercall.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/chirpy:saul@bettercall.com?") || !strings.Contains(uri, "secret="+rfc6238Secret) {
+		t.Fatalf("Unexpected uri %s", uri)
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes := GenerateRecoveryCodes()
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("Expected %d codes got %d", RecoveryCodeCount, len(codes))
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if seen[code] {
+			t.Fatalf("Duplicated recovery code %s", code)
+		}
+		seen[code] = true
+	}
+}
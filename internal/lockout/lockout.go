@@ -0,0 +1,141 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// State is what a store remembers about a key, failures older than the policy window are dropped.
+type State struct {
+	Failures      int
+	LastFailureAt time.Time
+}
+
+type Store interface {
+	Get(ctx context.Context, key string) (State, error)
+	// RecordFailure restarts the count when the previous failure happened before windowStart.
+	RecordFailure(ctx context.Context, key string, at, windowStart time.Time) (State, error)
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy lets FreeAttempts through, then doubles the wait from BaseDelay up to MaxDelay
+// and locks the key for LockoutDuration once MaxFailures is reached.
+// Window must be at least LockoutDuration or a lockout is forgotten early.
+type Policy struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	MaxFailures     int
+	LockoutDuration time.Duration
+	Window          time.Duration
+}
+
+func (p Policy) delay(failures int) time.Duration {
+	if failures >= p.MaxFailures {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+type Tracker struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+func NewTracker(store Store, policy Policy) *Tracker {
+	return &Tracker{store: store, policy: policy, now: time.Now}
+}
+
+func (t *Tracker) retryAfter(state State) time.Duration {
+	if state.Failures == 0 {
+		return 0
+	}
+	return max(state.LastFailureAt.Add(t.policy.delay(state.Failures)).Sub(t.now()), 0)
+}
+
+// RetryAfter returns how long the most restricted key must wait, zero when all are allowed.
+func (t *Tracker) RetryAfter(ctx context.Context, keys ...string) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range keys {
+		state, err := t.store.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		wait = max(wait, t.retryAfter(state))
+	}
+	return wait, nil
+}
+
+func (t *Tracker) Fail(ctx context.Context, keys ...string) error {
+	now := t.now()
+	for _, key := range keys {
+		if _, err := t.store.RecordFailure(ctx, key, now, now.Add(-t.policy.Window)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Tracker) Reset(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := t.store.Reset(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MemoryStore only protects a single instance and forgets everything on restart.
+type MemoryStore struct {
+	mu       sync.Mutex
+	states   map[string]State
+	prunedAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{states: map[string]State{}}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.states[key], nil
+}
+
+func (s *MemoryStore) RecordFailure(_ context.Context, key string, at, windowStart time.Time) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.states[key]
+	if state.LastFailureAt.Before(windowStart) {
+		state.Failures = 0
+	}
+	state.Failures++
+	state.LastFailureAt = at
+	s.states[key] = state
+	// Keep the map from growing forever with keys that will never be looked at again.
+	if s.prunedAt.Before(windowStart) {
+		for k, st := range s.states {
+			if st.LastFailureAt.Before(windowStart) {
+				delete(s.states, k)
+			}
+		}
+		s.prunedAt = at
+	}
+	return state, nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, key)
+	return nil
+}
@@ -0,0 +1,100 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeAttempts:    2,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Second * 4,
+	MaxFailures:     6,
+	LockoutDuration: time.Minute,
+	Window:          time.Hour,
+}
+
+func TestPolicyDelay(t *testing.T) {
+	testCases := map[string]struct {
+		failures int
+		delay    time.Duration
+	}{
+		"no failure":       {failures: 0, delay: 0},
+		"free attempt":     {failures: 2, delay: 0},
+		"first backoff":    {failures: 3, delay: time.Second},
+		"doubled backoff":  {failures: 4, delay: time.Second * 2},
+		"capped backoff":   {failures: 5, delay: time.Second * 4},
+		"locked out":       {failures: 6, delay: time.Minute},
+		"still locked out": {failures: 20, delay: time.Minute},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if delay := testPolicy.delay(test.failures); delay != test.delay {
+				t.Fatalf("Invalid delay\nexpected: %v\ngot: %v", test.delay, delay)
+			}
+		})
+	}
+}
+
+func newTestTracker(now *time.Time) *Tracker {
+	tracker := NewTracker(NewMemoryStore(), testPolicy)
+	tracker.now = func() time.Time { return *now }
+	return tracker
+}
+
+func TestTrackerLockout(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	tracker := newTestTracker(&now)
+
+	for range testPolicy.MaxFailures {
+		if err := tracker.Fail(ctx, "account:saul@bettercall.com"); err != nil {
+			t.Fatalf("Failed with error %#v", err)
+		}
+	}
+	wait, err := tracker.RetryAfter(ctx, "ip:127.0.0.1", "account:saul@bettercall.com")
+	if err != nil {
+		t.Fatalf("Failed with error %#v", err)
+	}
+	if wait != testPolicy.LockoutDuration {
+		t.Fatalf("Invalid wait\nexpected: %v\ngot: %v", testPolicy.LockoutDuration, wait)
+	}
+
+	now = now.Add(testPolicy.LockoutDuration)
+	if wait, _ := tracker.RetryAfter(ctx, "account:saul@bettercall.com"); wait != 0 {
+		t.Fatalf("Lockout should have expired, still waiting %v", wait)
+	}
+}
+
+func TestTrackerReset(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	tracker := newTestTracker(&now)
+
+	for range testPolicy.MaxFailures {
+		tracker.Fail(ctx, "account:saul@bettercall.com")
+	}
+	if err := tracker.Reset(ctx, "account:saul@bettercall.com"); err != nil {
+		t.Fatalf("Failed with error %#v", err)
+	}
+	if wait, _ := tracker.RetryAfter(ctx, "account:saul@bettercall.com"); wait != 0 {
+		t.Fatalf("Reset should clear the lockout, still waiting %v", wait)
+	}
+}
+
+func TestTrackerWindow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	tracker := newTestTracker(&now)
+
+	for range testPolicy.MaxFailures - 1 {
+		tracker.Fail(ctx, "account:saul@bettercall.com")
+	}
+	now = now.Add(testPolicy.Window + time.Second)
+	tracker.Fail(ctx, "account:saul@bettercall.com")
+	if wait, _ := tracker.RetryAfter(ctx, "account:saul@bettercall.com"); wait != 0 {
+		t.Fatalf("Failures outside of the window should be forgotten, waiting %v", wait)
+	}
+}
@@ -0,0 +1,47 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+// PostgresStore shares failures between instances and survives restarts.
+// Times are stored in UTC since the columns carry no time zone.
+type PostgresStore struct {
+	db *database.Queries
+}
+
+func NewPostgresStore(db *database.Queries) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (State, error) {
+	failure, err := s.db.GetLoginFailure(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, err
+	}
+	return State{Failures: int(failure.Failures), LastFailureAt: failure.LastFailureAt}, nil
+}
+
+func (s *PostgresStore) RecordFailure(ctx context.Context, key string, at, windowStart time.Time) (State, error) {
+	failure, err := s.db.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+		Key:         key,
+		FailedAt:    at.UTC(),
+		WindowStart: windowStart.UTC(),
+	})
+	if err != nil {
+		return State{}, err
+	}
+	return State{Failures: int(failure.Failures), LastFailureAt: failure.LastFailureAt}, nil
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	return s.db.DeleteLoginFailure(ctx, key)
+}
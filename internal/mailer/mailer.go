@@ -0,0 +1,107 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+var headerSanitizer = strings.NewReplacer("\r", "", "\n", "")
+
+// bytes renders the message as a minimal RFC 5322 email.
+func (m Message) bytes(from string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerSanitizer.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerSanitizer.Replace(m.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerSanitizer.Replace(m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(m.Body)
+	return []byte(b.String())
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer authenticates with PLAIN when a username is given.
+func NewSMTPMailer(addr, username, password, from string) (*SMTPMailer, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid smtp address %s %v", addr, err)
+	}
+	m := &SMTPMailer{addr: addr, from: from}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(_ context.Context, msg Message) error {
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, msg.bytes(m.from))
+}
+
+// FileMailer writes every message to its own .eml file so mails can be inspected without a network.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(_ context.Context, msg Message) error {
+	f, err := os.CreateTemp(m.dir, fmt.Sprintf("%d-*.eml", time.Now().UnixNano()))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(msg.bytes(m.from))
+	return err
+}
+
+// Messages returns the paths of every mail written so far, oldest first.
+func (m *FileMailer) Messages() ([]string, error) {
+	return filepath.Glob(filepath.Join(m.dir, "*.eml"))
+}
+
+// ConsoleMailer prints messages, it is the default when no mail transport is configured.
+type ConsoleMailer struct {
+	mu   sync.Mutex
+	out  io.Writer
+	from string
+}
+
+func NewConsoleMailer(out io.Writer, from string) *ConsoleMailer {
+	return &ConsoleMailer{out: out, from: from}
+}
+
+func (m *ConsoleMailer) Send(_ context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := fmt.Fprintf(m.out, "%s\r\n\r\n", msg.bytes(m.from))
+	return err
+}
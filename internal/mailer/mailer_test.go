@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testSender = "chirpy@localhost"
+
+func TestFileMailer(t *testing.T) {
+	m, err := NewFileMailer(t.TempDir(), testSender)
+	if err != nil {
+		t.Fatalf("Failed creating mailer %v", err)
+	}
+	messages := []Message{
+		{To: "saul@bettercall.com", Subject: "First", Body: "Hello Saul"},
+		{To: "walter@breakingbad.com", Subject: "Second", Body: "Hello Walter"},
+	}
+	for _, msg := range messages {
+		if err := m.Send(context.Background(), msg); err != nil {
+			t.Fatalf("Failed sending %#v %v", msg, err)
+		}
+	}
+	paths, err := m.Messages()
+	if err != nil {
+		t.Fatalf("Failed listing messages %v", err)
+	}
+	if len(paths) != len(messages) {
+		t.Fatalf("Expected %d messages got %d", len(messages), len(paths))
+	}
+	for i, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed reading %s %v", path, err)
+		}
+		content := string(raw)
+		if !strings.Contains(content, "To: "+messages[i].To) || !strings.HasSuffix(content, messages[i].Body) {
+			t.Fatalf("Unexpected message content\n%s", content)
+		}
+	}
+}
+
+func TestMessageHeaderInjection(t *testing.T) {
+	out := bytes.Buffer{}
+	m := NewConsoleMailer(&out, testSender)
+	msg := Message{To: "saul@bettercall.com\r\nBcc: everyone@example.com", Subject: "Hi", Body: "Hello"}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Failed sending %v", err)
+	}
+	if strings.Contains(out.String(), "\r\nBcc:") {
+		t.Fatalf("Header injection was not prevented\n%s", out.String())
+	}
+}
@@ -0,0 +1,252 @@
+package profanity
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const mask = "****"
+
+// lookAlikes are the digits and symbols commonly typed instead of a letter. 1 and | are
+// used for both i and l, so either letter accepts them without the two being confused.
+var lookAlikes = map[rune]string{
+	'a': "4@",
+	'b': "8",
+	'e': "3",
+	'i': "1!|",
+	'l': "1|",
+	'o': "0",
+	's': "5$",
+	't': "7",
+}
+
+// fold lowercases text and strips its accents, "Fórnàx" folds to "fornax".
+func fold(text string) string {
+	b := strings.Builder{}
+	for _, r := range norm.NFD.String(text) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// runeClass matches r and everything typed in its place, a look-alike listed in a word
+// matches every letter it can stand for.
+func runeClass(r rune) string {
+	runes := string(r)
+	if alikes, ok := lookAlikes[r]; ok {
+		runes += alikes
+	}
+	for letter, alikes := range lookAlikes {
+		if strings.ContainsRune(alikes, r) {
+			runes += string(letter) + alikes
+		}
+	}
+	return "[" + regexp.QuoteMeta(runes) + "]"
+}
+
+// wordPattern matches the folded word with look-alikes and letters repeated at will, a
+// run of n letters still needs at least n of them so "ass" never matches "as".
+func wordPattern(word string) string {
+	b := strings.Builder{}
+	runes := []rune(fold(word))
+	for i := 0; i < len(runes); {
+		n := 1
+		for i+n < len(runes) && runes[i+n] == runes[i] {
+			n++
+		}
+		fmt.Fprintf(&b, "%s{%d,}", runeClass(runes[i]), n)
+		i += n
+	}
+	return b.String()
+}
+
+// ValidateWord only accepts single words, the filter never matches across whitespace.
+func ValidateWord(word string) error {
+	if strings.TrimSpace(word) == "" || strings.IndexFunc(word, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("Invalid profane word %q, it must be a single word", word)
+	}
+	return nil
+}
+
+// LoadWords reads one word per line, blank lines and lines starting with # are ignored.
+func LoadWords(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	words := []string{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		word := strings.TrimSpace(scanner.Text())
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		if err := ValidateWord(word); err != nil {
+			return nil, fmt.Errorf("%v on line %d of %s", err, line, path)
+		}
+		words = append(words, word)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+// Match is a byte range of the checked text, Word is the listed word it matched.
+type Match struct {
+	Start int
+	End   int
+	Word  string
+}
+
+// Filter is safe for concurrent use, SetWords swaps the list while chirps are checked.
+type Filter struct {
+	mu sync.RWMutex
+	// pattern has one group per listed word, words[i] is the word of group i+1.
+	pattern *regexp.Regexp
+	words   []string
+}
+
+func NewFilter(words []string) *Filter {
+	f := &Filter{}
+	f.SetWords(words)
+	return f
+}
+
+func (f *Filter) SetWords(words []string) {
+	listed := []string{}
+	groups := []string{}
+	for _, word := range words {
+		word = strings.ToLower(word)
+		if fold(word) == "" || slices.Contains(listed, word) {
+			continue
+		}
+		listed = append(listed, word)
+		groups = append(groups, "("+wordPattern(word)+")")
+	}
+	var pattern *regexp.Regexp
+	if len(groups) > 0 {
+		pattern = regexp.MustCompile("^(?:" + strings.Join(groups, "|") + ")$")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pattern = pattern
+	f.words = listed
+}
+
+// lookup reports the listed word text is a disguise of, text must be a whole word.
+func (f *Filter) lookup(text string) (string, bool) {
+	if f.pattern == nil {
+		return "", false
+	}
+	groups := f.pattern.FindStringSubmatchIndex(fold(text))
+	for i := 1; i < len(groups)/2; i++ {
+		if groups[2*i] >= 0 {
+			return f.words[i-1], true
+		}
+	}
+	return "", false
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) || r == '@' || r == '$'
+}
+
+// isInnerWordRune is for symbols that only stand for a letter in the middle of a word,
+// "sh!t" hides a word while "fornax!" is only shouting.
+func isInnerWordRune(r rune) bool {
+	return r == '!' || r == '|'
+}
+
+type span struct {
+	start, end int
+}
+
+// tokens splits a whitespace free chunk of text into words, dropping the punctuation around them.
+func tokens(chunk []rune, offsets []int, end int) []span {
+	spans := []span{}
+	start := -1
+	for i, r := range chunk {
+		inWord := isWordRune(r) ||
+			(isInnerWordRune(r) && start >= 0 && i+1 < len(chunk) && isWordRune(chunk[i+1]))
+		if inWord && start < 0 {
+			start = i
+		}
+		if !inWord && start >= 0 {
+			spans = append(spans, span{offsets[start], offsets[i]})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, span{offsets[start], end})
+	}
+	return spans
+}
+
+// Find reports every listed word in text. Words split by punctuation without any space,
+// like "f.o.r.n.a.x", are matched as a whole.
+func (f *Filter) Find(text string) []Match {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	matches := []Match{}
+	var chunk []rune
+	var offsets []int
+	flush := func(end int) {
+		defer func() { chunk, offsets = nil, nil }()
+		spans := tokens(chunk, offsets, end)
+		if len(spans) == 0 {
+			return
+		}
+		if len(spans) > 1 {
+			joined := strings.Builder{}
+			for _, s := range spans {
+				joined.WriteString(text[s.start:s.end])
+			}
+			if word, ok := f.lookup(joined.String()); ok {
+				matches = append(matches, Match{Start: spans[0].start, End: spans[len(spans)-1].end, Word: word})
+				return
+			}
+		}
+		for _, s := range spans {
+			if word, ok := f.lookup(text[s.start:s.end]); ok {
+				matches = append(matches, Match{Start: s.start, End: s.end, Word: word})
+			}
+		}
+	}
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			flush(i)
+			continue
+		}
+		chunk = append(chunk, r)
+		offsets = append(offsets, i)
+	}
+	flush(len(text))
+	return matches
+}
+
+// Mask replaces every match with asterisks, whitespace and punctuation around it are kept.
+func (f *Filter) Mask(text string) (string, []Match) {
+	matches := f.Find(text)
+	b := strings.Builder{}
+	last := 0
+	for _, m := range matches {
+		b.WriteString(text[last:m.Start])
+		b.WriteString(mask)
+		last = m.End
+	}
+	b.WriteString(text[last:])
+	return b.String(), matches
+}
@@ -0,0 +1,108 @@
+package profanity
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFilterMask(t *testing.T) {
+	filter := NewFilter([]string{"kerfuffle", "sharbert", "fornax"})
+	testCases := map[string]struct {
+		text     string
+		expected string
+		words    []string
+	}{
+		"clean":             {text: "I'm the one who knocks!", expected: "I'm the one who knocks!", words: []string{}},
+		"whole word":        {text: "What a kerfuffle", expected: "What a ****", words: []string{"kerfuffle"}},
+		"punctuation":       {text: "Kerfuffle! Sharbert, fornax.", expected: "****! ****, ****.", words: []string{"kerfuffle", "sharbert", "fornax"}},
+		"case":              {text: "FoRnAx", expected: "****", words: []string{"fornax"}},
+		"leetspeak":         {text: "sh@rb3rt and f0rn4x", expected: "**** and ****", words: []string{"sharbert", "fornax"}},
+		"inner symbol":      {text: "k3rfuff|e", expected: "****", words: []string{"kerfuffle"}},
+		"repeated letters":  {text: "fornaaaax", expected: "****", words: []string{"fornax"}},
+		"accents":           {text: "fórnàx", expected: "****", words: []string{"fornax"}},
+		"split by dots":     {text: "f.o.r.n.a.x", expected: "****", words: []string{"fornax"}},
+		"glued words":       {text: "kerfuffle,fornax", expected: "****,****", words: []string{"kerfuffle", "fornax"}},
+		"whitespace kept":   {text: "a\tkerfuffle\n\nb  fornax", expected: "a\t****\n\nb  ****", words: []string{"kerfuffle", "fornax"}},
+		"substring allowed": {text: "fornaxes", expected: "fornaxes", words: []string{}},
+		"quoted":            {text: `"sharbert"`, expected: `"****"`, words: []string{"sharbert"}},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			masked, matches := filter.Mask(test.text)
+			if masked != test.expected {
+				t.Fatalf("Invalid masking\nexpected: %q\ngot: %q", test.expected, masked)
+			}
+			words := []string{}
+			for _, m := range matches {
+				words = append(words, m.Word)
+			}
+			if !slices.Equal(words, test.words) {
+				t.Fatalf("Invalid matches\nexpected: %v\ngot: %v", test.words, words)
+			}
+		})
+	}
+}
+
+func TestFilterFalsePositives(t *testing.T) {
+	filter := NewFilter([]string{"ass", "boob", "lamb"})
+	testCases := map[string]struct {
+		text  string
+		words []string
+	}{
+		"shorter run":        {text: "as", words: []string{}},
+		"sentence":           {text: "As long as it works", words: []string{}},
+		"collapsed run":      {text: "Bob", words: []string{}},
+		"l is not i":         {text: "iamb", words: []string{}},
+		"listed word":        {text: "ass", words: []string{"ass"}},
+		"longer run":         {text: "asssss", words: []string{"ass"}},
+		"look-alikes in run": {text: "a$5", words: []string{"ass"}},
+		"digits":             {text: "B00B", words: []string{"boob"}},
+		"one for l":          {text: "1amb", words: []string{"lamb"}},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			words := []string{}
+			for _, m := range filter.Find(test.text) {
+				words = append(words, m.Word)
+			}
+			if !slices.Equal(words, test.words) {
+				t.Fatalf("Invalid matches\nexpected: %v\ngot: %v", test.words, words)
+			}
+		})
+	}
+}
+
+func TestFilterSetWords(t *testing.T) {
+	filter := NewFilter([]string{"kerfuffle"})
+	filter.SetWords([]string{"Heisenberg"})
+	if len(filter.Find("kerfuffle")) != 0 {
+		t.Fatalf("Replaced words should not match anymore")
+	}
+	if len(filter.Find("h3isenberg")) != 1 {
+		t.Fatalf("New words should match")
+	}
+}
+
+func TestLoadWords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte("# team list\nkerfuffle\n\n  Sharbert  \n"), 0o600); err != nil {
+		t.Fatalf("Failed writing list %v", err)
+	}
+	words, err := LoadWords(path)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !slices.Equal(words, []string{"kerfuffle", "Sharbert"}) {
+		t.Fatalf("Invalid words %v", words)
+	}
+	if err := os.WriteFile(path, []byte("two words\n"), 0o600); err != nil {
+		t.Fatalf("Failed writing list %v", err)
+	}
+	if _, err := LoadWords(path); err == nil {
+		t.Fatalf("Phrases should be refused")
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -10,5 +11,11 @@ import (
 
 func main() {
 	godotenv.Load()
+	if len(os.Args) > 1 {
+		if err := server.RunCommand(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	log.Fatal(server.Run())
 }
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/auth"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+const (
+	defaultAccountDeletionGracePeriod = 30 * 24 * time.Hour
+	accountPurgeInterval              = time.Hour
+)
+
+var errAccountPendingDeletion = errors.New("Account is pending deletion")
+
+// purgeDeletedAccounts hard-deletes the accounts whose grace period is over, the foreign
+// keys cascade to their chirps, tokens and sessions. Chirps with replies are left as
+// tombstones without an author.
+func purgeDeletedAccounts(ctx context.Context, db database.Querier, now time.Time, gracePeriod time.Duration) ([]uuid.UUID, error) {
+	return db.DeleteUsersPendingDeletion(ctx, dbTime(now.Add(-gracePeriod)))
+}
+
+// runAccountPurge blocks until ctx is done, it is meant to run in its own goroutine.
+func runAccountPurge(ctx context.Context, db database.Querier, gracePeriod time.Duration, exports *dataExporter) {
+	ticker := time.NewTicker(accountPurgeInterval)
+	defer ticker.Stop()
+	for {
+		ids, err := purgeDeletedAccounts(ctx, db, time.Now(), gracePeriod)
+		if err != nil {
+			log.Printf("Failed purging deleted accounts %v", err)
+		}
+		for _, id := range ids {
+			log.Printf("Deleted account %s after its grace period", id)
+			if err := exports.removeUserFiles(id); err != nil {
+				log.Printf("Failed removing data exports of %s %v", id, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func getDeleteUserHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type requestBody struct {
+			Password string `json:"password"`
+		}
+		type responseBody struct {
+			DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+		}
+		uid, err := cfg.authenticate(r, auth.ScopeSession)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		decoder := json.NewDecoder(r.Body)
+		req := requestBody{}
+		if err := decoder.Decode(&req); err != nil || req.Password == "" {
+			respondWithErrorJSON(w, http.StatusBadRequest, fmt.Errorf("Bad request %v", err))
+			return
+		}
+		user, err := cfg.db.GetUserById(r.Context(), uid)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		if user.DeletionRequestedAt.Valid {
+			respondWithErrorJSON(w, http.StatusConflict, errAccountPendingDeletion)
+			return
+		}
+		// Passwordless accounts have to set a password first, a stolen session alone
+		// must not be enough to delete an account.
+		if user.HashedPassword == noPassword {
+			respondWithErrorJSON(w, http.StatusForbidden, errors.New("Set a password before deleting your account"))
+			return
+		}
+		if match, err := auth.CheckPasswordHash(req.Password, user.HashedPassword); err != nil || !match {
+			cfg.audit.record(r, uid, auditDeletionRequest, auditEmail(user.Email), auditFailure)
+			respondWithErrorJSON(w, http.StatusUnauthorized, errors.New("Incorrect password"))
+			return
+		}
+		user, err = requestUserDeletion(cfg, r, uid)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErrorJSON(w, http.StatusConflict, errAccountPendingDeletion)
+			return
+		}
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		clearSessionCookies(w)
+		cfg.audit.record(r, uid, auditDeletionRequest, auditEmail(user.Email), auditSuccess)
+		respondWithJSON(w, http.StatusAccepted, responseBody{
+			DeletionScheduledAt: user.DeletionRequestedAt.Time.Add(cfg.accountDeletionGracePeriod),
+		})
+	})
+}
+
+// requestUserDeletion schedules the account for deletion and revokes every way
+// of acting on its behalf, sessions and personal access tokens alike, in one
+// transaction. Cancelling the deletion does not bring them back.
+func requestUserDeletion(cfg *apiConfig, r *http.Request, uid uuid.UUID) (database.User, error) {
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+	queries := database.New(tx)
+	user, err := queries.RequestUserDeletion(r.Context(), uid)
+	if err != nil {
+		return database.User{}, err
+	}
+	if err := queries.RevokeAllRefreshTokensByUserID(r.Context(), uid); err != nil {
+		return database.User{}, err
+	}
+	if err := queries.RevokeAllPersonalAccessTokensByUserID(r.Context(), uid); err != nil {
+		return database.User{}, err
+	}
+	return user, tx.Commit()
+}
+
+func getCancelUserDeletionHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, err := cfg.authenticate(r, auth.ScopeSession)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		cancelled, err := cfg.db.CancelUserDeletion(r.Context(), uid)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if cancelled == 0 {
+			respondWithErrorJSON(w, http.StatusConflict, errors.New("Account is not pending deletion"))
+			return
+		}
+		cfg.audit.record(r, uid, auditDeletionCancel, "", auditSuccess)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+// DeleteUsersPendingDeletion refuses zoned times like the timestamp column would misread them.
+func (db *memoryQueries) DeleteUsersPendingDeletion(_ context.Context, requestedBefore time.Time) ([]uuid.UUID, error) {
+	if requestedBefore.Location() != time.UTC {
+		return nil, fmt.Errorf("requestedBefore must be in UTC, got %v", requestedBefore.Location())
+	}
+	deleted := []uuid.UUID{}
+	for id, user := range db.users {
+		if user.DeletionRequestedAt.Valid && user.DeletionRequestedAt.Time.Before(requestedBefore) {
+			deleted = append(deleted, id)
+			delete(db.users, id)
+		}
+	}
+	return deleted, nil
+}
+
+func TestPurgeDeletedAccounts(t *testing.T) {
+	now := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	gracePeriod := 7 * 24 * time.Hour
+	expired, lastMinute, recent := uuid.New(), uuid.New(), uuid.New()
+	testCases := map[string]struct {
+		requestedAt time.Time
+		id          uuid.UUID
+		deleted     bool
+	}{
+		"grace period over":   {requestedAt: now.Add(-gracePeriod - time.Hour), id: expired, deleted: true},
+		"grace period ending": {requestedAt: now.Add(-gracePeriod + time.Minute), id: lastMinute},
+		"just requested":      {requestedAt: now.Add(-time.Hour), id: recent},
+	}
+
+	db := newMemoryQueries()
+	for _, test := range testCases {
+		db.users[test.id] = database.User{
+			ID:                  test.id,
+			DeletionRequestedAt: sql.NullTime{Time: test.requestedAt, Valid: true},
+		}
+	}
+	deleted, err := purgeDeletedAccounts(context.Background(), db, now.In(time.FixedZone("CEST", 2*60*60)), gracePeriod)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if slices.Contains(deleted, test.id) != test.deleted {
+				t.Fatalf("Invalid purge\nexpected deleted: %t\ngot: %v", test.deleted, deleted)
+			}
+		})
+	}
+}
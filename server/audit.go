@@ -0,0 +1,227 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/auth"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+type auditAction string
+
+const (
+	auditPasswordLogin        = auditAction("login.password")
+	auditTwoFactorLogin       = auditAction("login.2fa")
+	auditMagicLinkLogin       = auditAction("login.magic_link")
+	auditLogout               = auditAction("logout")
+	auditRefreshTokenReuse    = auditAction("refresh_token.reuse")
+	auditUserCreate           = auditAction("user.create")
+	auditEmailChange          = auditAction("user.email_change")
+	auditPasswordChange       = auditAction("user.password_change")
+	auditEmailVerify          = auditAction("user.email_verify")
+	auditChirpyRedUpgrade     = auditAction("user.chirpy_red_upgrade")
+	auditDeletionRequest      = auditAction("user.deletion_request")
+	auditDeletionCancel       = auditAction("user.deletion_cancel")
+	auditDataExport           = auditAction("user.data_export")
+	auditPasswordResetRequest = auditAction("password_reset.request")
+	auditPasswordReset        = auditAction("password_reset.confirm")
+	auditTwoFactorEnable      = auditAction("2fa.enable")
+	auditTwoFactorDisable     = auditAction("2fa.disable")
+	auditSessionRevoke        = auditAction("session.revoke")
+	auditSessionRevokeAll     = auditAction("session.revoke_all")
+	auditTokenCreate          = auditAction("personal_access_token.create")
+	auditTokenRevoke          = auditAction("personal_access_token.revoke")
+	auditOAuthAuthorize       = auditAction("oauth.authorize")
+	auditOAuthClientCreate    = auditAction("oauth.client_create")
+	auditLockoutClear         = auditAction("admin.lockout_clear")
+	auditProfaneWordAdd       = auditAction("admin.profane_word_add")
+	auditProfaneWordRemove    = auditAction("admin.profane_word_remove")
+	auditChirpApprove         = auditAction("moderation.chirp_approve")
+	auditChirpReject          = auditAction("moderation.chirp_reject")
+)
+
+type auditOutcome string
+
+const (
+	auditSuccess = auditOutcome("success")
+	auditFailure = auditOutcome("failure")
+)
+
+const (
+	securityEventsLimit   = 100
+	auditEventsMaxResults = 1000
+)
+
+// auditLog never fails the request it records, failed writes are only logged and counted
+// so they show up on the admin metrics.
+type auditLog struct {
+	db       database.Querier
+	failures atomic.Int64
+}
+
+func newAuditLog(db database.Querier) *auditLog {
+	return &auditLog{db: db}
+}
+
+// auditEmail pseudonymizes the addresses used as targets, the audit log is append-only and
+// outlives the account so it must never hold the raw address. An admin who knows an address
+// can still find its events by hashing it the same way.
+func auditEmail(email string) string {
+	return "email:" + auth.HashToken(strings.ToLower(email))
+}
+
+// record uses uuid.Nil when the actor is unknown, failed logins on an existing account
+// are recorded as that account so its owner can see them.
+func (l *auditLog) record(r *http.Request, actorID uuid.UUID, action auditAction, target string, outcome auditOutcome) {
+	client := clientInfoFromRequest(r)
+	// The event must be written even when the client already went away.
+	ctx := context.WithoutCancel(r.Context())
+	if err := l.db.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+		ActorID:   uuid.NullUUID{UUID: actorID, Valid: actorID != uuid.Nil},
+		Action:    string(action),
+		Target:    target,
+		IpAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+		Outcome:   string(outcome),
+	}); err != nil {
+		l.failures.Add(1)
+		log.Printf("Failed recording audit event %s %v", action, err)
+	}
+}
+
+// requestActor is for routes that only check the role, it never fails.
+func (cfg *apiConfig) requestActor(r *http.Request) uuid.UUID {
+	uid, err := cfg.authenticate(r, auth.ScopeSession)
+	if err != nil {
+		return uuid.Nil
+	}
+	return uid
+}
+
+type AuditEvent struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ActorID   *uuid.UUID `json:"actor_id"`
+	Action    string     `json:"action"`
+	Target    string     `json:"target"`
+	IPAddress string     `json:"ip_address"`
+	UserAgent string     `json:"user_agent"`
+	Outcome   string     `json:"outcome"`
+}
+
+func fromDbAuditEvent(e database.AuditEvent) AuditEvent {
+	event := AuditEvent{
+		ID:        e.ID,
+		CreatedAt: e.CreatedAt,
+		Action:    e.Action,
+		Target:    e.Target,
+		IPAddress: e.IpAddress,
+		UserAgent: e.UserAgent,
+		Outcome:   e.Outcome,
+	}
+	if e.ActorID.Valid {
+		event.ActorID = &e.ActorID.UUID
+	}
+	return event
+}
+
+func getSecurityEventsHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, err := cfg.authenticate(r, auth.ScopeSession)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		events, err := cfg.db.GetAuditEventsByActorID(r.Context(), database.GetAuditEventsByActorIDParams{
+			ActorID: uuid.NullUUID{UUID: uid, Valid: true},
+			Limit:   securityEventsLimit,
+		})
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		res := []AuditEvent{}
+		for _, event := range events {
+			res = append(res, fromDbAuditEvent(event))
+		}
+		respondWithJSON(w, http.StatusOK, res)
+	})
+}
+
+func parseFilterTime(query url.Values, name string) (sql.NullTime, error) {
+	raw := query.Get(name)
+	if raw == "" {
+		return sql.NullTime{}, nil
+	}
+	at, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return sql.NullTime{}, fmt.Errorf("Invalid %s %q", name, raw)
+	}
+	return sql.NullTime{Time: dbTime(at), Valid: true}, nil
+}
+
+// parseAuditEventsFilter reads actor_id, action, outcome, since and until (RFC 3339) and limit.
+func parseAuditEventsFilter(query url.Values) (database.GetAuditEventsParams, error) {
+	filter := database.GetAuditEventsParams{MaxResults: auditEventsMaxResults}
+	if actorID := query.Get("actor_id"); actorID != "" {
+		id, err := uuid.Parse(actorID)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid actor_id %q", actorID)
+		}
+		filter.ActorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+	if action := query.Get("action"); action != "" {
+		filter.Action = sql.NullString{String: action, Valid: true}
+	}
+	if outcome := query.Get("outcome"); outcome != "" {
+		if outcome != string(auditSuccess) && outcome != string(auditFailure) {
+			return filter, fmt.Errorf("Invalid outcome %q", outcome)
+		}
+		filter.Outcome = sql.NullString{String: outcome, Valid: true}
+	}
+	var err error
+	if filter.Since, err = parseFilterTime(query, "since"); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = parseFilterTime(query, "until"); err != nil {
+		return filter, err
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.ParseInt(limit, 10, 32)
+		if err != nil || n <= 0 || n > auditEventsMaxResults {
+			return filter, fmt.Errorf("Limit must be between 1 and %d", auditEventsMaxResults)
+		}
+		filter.MaxResults = int32(n)
+	}
+	return filter, nil
+}
+
+func getAuditEventsHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseAuditEventsFilter(r.URL.Query())
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusBadRequest, err)
+			return
+		}
+		events, err := cfg.db.GetAuditEvents(r.Context(), filter)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		res := []AuditEvent{}
+		for _, event := range events {
+			res = append(res, fromDbAuditEvent(event))
+		}
+		respondWithJSON(w, http.StatusOK, res)
+	})
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+func (db *memoryQueries) CreateAuditEvent(_ context.Context, arg database.CreateAuditEventParams) error {
+	if db.auditErr != nil {
+		return db.auditErr
+	}
+	db.auditEvents = append(db.auditEvents, arg)
+	return nil
+}
+
+func TestAuditLogRecord(t *testing.T) {
+	db := newMemoryQueries()
+	audit := newAuditLog(db)
+	req := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	req.Header.Set("User-Agent", "bruno-runtime/1.0")
+	uid := uuid.New()
+
+	audit.record(req, uid, auditPasswordLogin, auditEmail("saul@bettercall.com"), auditSuccess)
+	audit.record(req, uuid.Nil, auditPasswordLogin, auditEmail("kim@bettercall.com"), auditFailure)
+	if len(db.auditEvents) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(db.auditEvents))
+	}
+	if event := db.auditEvents[0]; !event.ActorID.Valid || event.ActorID.UUID != uid || event.UserAgent != "bruno-runtime/1.0" || event.Outcome != "success" {
+		t.Fatalf("Invalid event %#v", event)
+	}
+	if event := db.auditEvents[1]; event.ActorID.Valid || event.Outcome != "failure" {
+		t.Fatalf("Unknown actor should be stored as null %#v", event)
+	}
+
+	db.auditErr = errors.New("connection refused")
+	audit.record(req, uid, auditLogout, "", auditSuccess)
+	if failures := audit.failures.Load(); failures != 1 {
+		t.Fatalf("Failed writes should be counted, got %d", failures)
+	}
+}
+
+func TestAuditEmail(t *testing.T) {
+	target := auditEmail("Saul@BetterCall.com")
+	if strings.Contains(strings.ToLower(target), "bettercall") {
+		t.Fatalf("Audit targets must not hold the address %q", target)
+	}
+	if target != auditEmail("saul@bettercall.com") {
+		t.Fatalf("Addresses differing in case should match")
+	}
+	if target == auditEmail("kim@bettercall.com") {
+		t.Fatalf("Different addresses should not match")
+	}
+}
+
+func TestParseAuditEventsFilter(t *testing.T) {
+	actorID := uuid.New()
+	testCases := map[string]struct {
+		query url.Values
+		valid bool
+		check func(database.GetAuditEventsParams) bool
+	}{
+		"no filter": {
+			query: url.Values{},
+			valid: true,
+			check: func(f database.GetAuditEventsParams) bool {
+				return !f.ActorID.Valid && !f.Action.Valid && !f.Since.Valid && f.MaxResults == auditEventsMaxResults
+			},
+		},
+		"every filter": {
+			query: url.Values{
+				"actor_id": {actorID.String()},
+				"action":   {"login.password"},
+				"outcome":  {"failure"},
+				"since":    {"2026-01-01T00:00:00+02:00"},
+				"limit":    {"10"},
+			},
+			valid: true,
+			check: func(f database.GetAuditEventsParams) bool {
+				since := time.Date(2025, 12, 31, 22, 0, 0, 0, time.UTC)
+				return f.ActorID.UUID == actorID && f.Action.String == "login.password" && f.Outcome.String == "failure" &&
+					f.Since.Time.Equal(since) && !f.Until.Valid && f.MaxResults == 10
+			},
+		},
+		"invalid actor":   {query: url.Values{"actor_id": {"saul"}}, valid: false},
+		"invalid outcome": {query: url.Values{"outcome": {"maybe"}}, valid: false},
+		"invalid since":   {query: url.Values{"since": {"yesterday"}}, valid: false},
+		"limit too big":   {query: url.Values{"limit": {"100000"}}, valid: false},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			filter, err := parseAuditEventsFilter(test.query)
+			if err != nil && test.valid {
+				t.Fatalf("Parsing failed for payload %#v: %v", test.query, err)
+			}
+			if err == nil && !test.valid {
+				t.Fatalf("Expected failure for payload %#v", test.query)
+			}
+			if test.valid && !test.check(filter) {
+				t.Fatalf("Invalid filter %#v", filter)
+			}
+		})
+	}
+}
@@ -1,25 +1,195 @@
 package server
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
+	"slices"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/the-1aw/chirpy/internal/auth"
 	"github.com/the-1aw/chirpy/internal/database"
 )
 
+const refreshTokenValidity = time.Hour * 24 * 60
+
+var (
+	errRefreshTokenInvalid = errors.New("Invalid refresh token")
+	errRefreshTokenReused  = errors.New("Refresh token reuse detected")
+	errInsufficientScope   = errors.New("Token is missing the required scope")
+)
+
+// authenticate accepts either an access JWT, which grants every scope unless it was
+// issued to an OAuth client, or a personal access token that must have been granted scope.
+// Browsers send the JWT as a cookie.
+func (cfg *apiConfig) authenticate(r *http.Request, scope auth.Scope) (uuid.UUID, error) {
+	tokenStr, _, err := requestToken(r, accessCookieName)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	if !auth.IsPersonalAccessToken(tokenStr) {
+		token, err := cfg.keys.ValidateAccessToken(tokenStr)
+		if err != nil {
+			return uuid.UUID{}, err
+		}
+		if !token.Allows(scope) {
+			return uuid.UUID{}, errInsufficientScope
+		}
+		return token.UserID, nil
+	}
+	pat, err := cfg.db.UsePersonalAccessToken(r.Context(), auth.HashToken(tokenStr))
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.UUID{}, errors.New("Invalid personal access token")
+	}
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	if !slices.Contains(pat.Scopes, string(scope)) {
+		return uuid.UUID{}, errInsufficientScope
+	}
+	return pat.UserID, nil
+}
+
+func respondWithAuthError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInsufficientScope) || errors.Is(err, errCSRFTokenInvalid) {
+		respondWithErrorJSON(w, http.StatusForbidden, err)
+		return
+	}
+	respondWithErrorJSON(w, http.StatusUnauthorized, err)
+}
+
+// rotateRefreshToken revokes the presented token and issues its successor in the same family.
+// Presenting a token that was already revoked means it leaked, so the whole family is revoked.
+// oauthClientID must match the client the token was issued to, it is null for first party tokens.
+// Along with errRefreshTokenReused the reused token is returned so its owner can be told.
+func (cfg *apiConfig) rotateRefreshToken(ctx context.Context, token string, oauthClientID uuid.NullUUID, client clientInfo) (database.RefreshToken, error) {
+	current, err := cfg.db.ConsumeRefreshToken(ctx, database.ConsumeRefreshTokenParams{
+		Token:    token,
+		ClientID: oauthClientID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		previous, err := cfg.db.GetRefreshTokenIncludingRevoked(ctx, token)
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.RefreshToken{}, errRefreshTokenInvalid
+		}
+		if err != nil {
+			return database.RefreshToken{}, err
+		}
+		if !previous.RevokedAt.Valid || previous.ClientID != oauthClientID {
+			// Expired but never used again, nothing suspicious.
+			return database.RefreshToken{}, errRefreshTokenInvalid
+		}
+		if _, err := cfg.db.RevokeRefreshTokenFamily(ctx, database.RevokeRefreshTokenFamilyParams{
+			FamilyID: previous.FamilyID,
+			UserID:   previous.UserID,
+		}); err != nil {
+			return database.RefreshToken{}, err
+		}
+		return previous, errRefreshTokenReused
+	}
+	if err != nil {
+		return database.RefreshToken{}, err
+	}
+	return cfg.db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		Token:     auth.MakeRefreshToken(),
+		ExpiresAt: time.Now().Add(refreshTokenValidity),
+		UserID:    current.UserID,
+		FamilyID:  current.FamilyID,
+		UserAgent: client.UserAgent,
+		IpAddress: client.IPAddress,
+		ClientID:  current.ClientID,
+		Scopes:    current.Scopes,
+	})
+}
+
+const mfaTokenValidity = time.Minute * 5
+
+type loginResponseBody struct {
+	User
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	CSRFToken    string `json:"csrf_token,omitempty"`
+}
+
+// respondWithLoginTokens starts a new session for a fully authenticated user, with
+// useCookies the tokens are only set as cookies and the body carries the csrf token.
+func respondWithLoginTokens(w http.ResponseWriter, r *http.Request, cfg *apiConfig, user database.User, useCookies bool) {
+	token, err := cfg.keys.MakeJWT(user.ID, auth.Role(user.Role), accessTokenValidity)
+	if err != nil {
+		respondWithErrorJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+	client := clientInfoFromRequest(r)
+	rt, err := cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:     auth.MakeRefreshToken(),
+		ExpiresAt: time.Now().Add(refreshTokenValidity),
+		UserID:    user.ID,
+		FamilyID:  uuid.New(),
+		UserAgent: client.UserAgent,
+		IpAddress: client.IPAddress,
+	})
+	if err != nil {
+		respondWithErrorJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+	if useCookies {
+		csrfToken := auth.MakeRefreshToken()
+		setSessionCookies(w, token, rt.Token, csrfToken)
+		respondWithJSON(w, http.StatusOK, loginResponseBody{
+			User:      fromDbUser(user),
+			CSRFToken: csrfToken,
+		})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, loginResponseBody{
+		User:         fromDbUser(user),
+		Token:        token,
+		RefreshToken: rt.Token,
+	})
+}
+
+// respondWithMFAChallenge replaces the tokens when the user still has to prove the second factor.
+func respondWithMFAChallenge(w http.ResponseWriter, cfg *apiConfig, user database.User) {
+	mfaToken, err := cfg.keys.MakeMFAToken(user.ID, mfaTokenValidity)
+	if err != nil {
+		respondWithErrorJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+	})
+}
+
+// upgradePasswordHash stores the password with the current parameters, a failure only
+// delays the upgrade to the next login.
+func upgradePasswordHash(ctx context.Context, cfg *apiConfig, userID uuid.UUID, password string) {
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("Failed rehashing password %v", err)
+		return
+	}
+	if err := cfg.db.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		ID:             userID,
+		HashedPassword: hashedPassword,
+	}); err != nil {
+		log.Printf("Failed upgrading password hash %v", err)
+	}
+}
+
 func getLoginHandler(cfg *apiConfig) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		type requestBody struct {
-			Email    string `json:"email"`
-			Password string `json:"password"`
-		}
-		type responseBody struct {
-			User
-			Token        string `json:"token"`
-			RefreshToken string `json:"refresh_token"`
+			Email      string `json:"email"`
+			Password   string `json:"password"`
+			UseCookies bool   `json:"use_cookies"`
 		}
 		decoder := json.NewDecoder(r.Body)
 		req := requestBody{}
@@ -27,71 +197,123 @@ func getLoginHandler(cfg *apiConfig) http.Handler {
 			respondWithErrorJSON(w, http.StatusInternalServerError, err)
 			return
 		}
+		client := clientInfoFromRequest(r)
+		wait, err := cfg.loginGuard.retryAfter(r.Context(), req.Email, client)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if wait > 0 {
+			respondWithRetryAfter(w, wait, errTooManyLoginAttempts)
+			return
+		}
 		user, err := cfg.db.GetUserByEmail(r.Context(), req.Email)
 		if err != nil {
-			respondWithErrorJSON(w, http.StatusUnauthorized, err)
+			if err := cfg.loginGuard.fail(r.Context(), req.Email, client); err != nil {
+				log.Printf("Failed recording login failure %v", err)
+			}
+			cfg.audit.record(r, uuid.Nil, auditPasswordLogin, auditEmail(req.Email), auditFailure)
+			respondWithErrorJSON(w, http.StatusUnauthorized, errors.New("Unauthorized"))
 			return
 		}
 		passMatches, err := auth.CheckPasswordHash(req.Password, user.HashedPassword)
-		if err != nil || !passMatches {
+		if user.HashedPassword == noPassword || err != nil || !passMatches {
+			if err := cfg.loginGuard.fail(r.Context(), req.Email, client); err != nil {
+				log.Printf("Failed recording login failure %v", err)
+			}
+			cfg.audit.record(r, user.ID, auditPasswordLogin, auditEmail(user.Email), auditFailure)
 			respondWithErrorJSON(w, http.StatusUnauthorized, errors.New("Unauthorized"))
 			return
 		}
-		token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
-		rt, err := cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-			Token:     auth.MakeRefreshToken(),
-			ExpiresAt: time.Now().Add(time.Hour * 24 * 60),
-			UserID:    user.ID,
-		})
-		if err != nil {
-			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+		if auth.NeedsRehash(user.HashedPassword) {
+			upgradePasswordHash(r.Context(), cfg, user.ID, req.Password)
+		}
+		// With two-factor enabled this only records the password step, login.2fa follows.
+		cfg.audit.record(r, user.ID, auditPasswordLogin, auditEmail(user.Email), auditSuccess)
+		if user.TotpEnabledAt.Valid {
+			respondWithMFAChallenge(w, cfg, user)
 			return
 		}
-		respondWithJSON(w, http.StatusOK, responseBody{
-			User:         fromDbUser(user),
-			Token:        token,
-			RefreshToken: rt.Token,
-		})
+		if err := cfg.loginGuard.succeed(r.Context(), user.Email); err != nil {
+			log.Printf("Failed clearing login failures %v", err)
+		}
+		respondWithLoginTokens(w, r, cfg, user, req.UseCookies)
 	})
 }
 
 func getRefreshHandler(cfg *apiConfig) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		refreshToken, err := auth.GetBearerToken(r.Header)
+		refreshToken, fromCookie, err := requestToken(r, refreshCookieName)
 		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		rt, err := cfg.rotateRefreshToken(r.Context(), refreshToken, uuid.NullUUID{}, clientInfoFromRequest(r))
+		if errors.Is(err, errRefreshTokenReused) {
+			cfg.audit.record(r, rt.UserID, auditRefreshTokenReuse, "", auditFailure)
+		}
+		if errors.Is(err, errRefreshTokenInvalid) || errors.Is(err, errRefreshTokenReused) {
 			respondWithErrorJSON(w, http.StatusUnauthorized, err)
 			return
 		}
-		rt, err := cfg.db.GetRefreshToken(r.Context(), refreshToken)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		user, err := cfg.db.GetUserById(r.Context(), rt.UserID)
 		if err != nil {
 			respondWithErrorJSON(w, http.StatusUnauthorized, err)
 			return
 		}
-		token, err := auth.MakeJWT(rt.UserID, cfg.jwtSecret, time.Hour)
+		token, err := cfg.keys.MakeJWT(user.ID, auth.Role(user.Role), accessTokenValidity)
 		if err != nil {
 			respondWithErrorJSON(w, http.StatusInternalServerError, err)
 			return
 		}
+		if fromCookie {
+			csrfToken := auth.MakeRefreshToken()
+			setSessionCookies(w, token, rt.Token, csrfToken)
+			respondWithJSON(w, http.StatusOK, struct {
+				CSRFToken string `json:"csrf_token"`
+			}{
+				CSRFToken: csrfToken,
+			})
+			return
+		}
 		respondWithJSON(w, http.StatusOK, struct {
-			Token string `json:"token"`
+			Token        string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
 		}{
-			Token: token,
+			Token:        token,
+			RefreshToken: rt.Token,
 		})
 	})
 }
 
 func getRevokeHandler(cfg *apiConfig) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		refreshToken, err := auth.GetBearerToken(r.Header)
+		refreshToken, fromCookie, err := requestToken(r, refreshCookieName)
 		if err != nil {
-			respondWithErrorJSON(w, http.StatusUnauthorized, err)
+			respondWithAuthError(w, err)
 			return
 		}
-		err = cfg.db.RevokeToken(r.Context(), refreshToken)
-		if err != nil {
+		rt, err := cfg.db.RevokeToken(r.Context(), refreshToken)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
 			respondWithErrorJSON(w, http.StatusInternalServerError, err)
 			return
 		}
+		if err == nil {
+			cfg.audit.record(r, rt.UserID, auditLogout, rt.FamilyID.String(), auditSuccess)
+		}
+		if fromCookie {
+			clearSessionCookies(w)
+		}
 		w.WriteHeader(http.StatusNoContent)
 	})
 }
+
+func getJWKSHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respondWithJSON(w, http.StatusOK, cfg.keys.JWKS())
+	})
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+func (db *memoryQueries) CreateRefreshToken(_ context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	rt := database.RefreshToken{
+		Token:     arg.Token,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt,
+		FamilyID:  arg.FamilyID,
+		UserAgent: arg.UserAgent,
+		IpAddress: arg.IpAddress,
+		ClientID:  arg.ClientID,
+		Scopes:    arg.Scopes,
+	}
+	db.refreshTokens[rt.Token] = rt
+	return rt, nil
+}
+
+func (db *memoryQueries) ConsumeRefreshToken(_ context.Context, arg database.ConsumeRefreshTokenParams) (database.RefreshToken, error) {
+	rt, ok := db.refreshTokens[arg.Token]
+	if !ok || rt.ClientID != arg.ClientID || rt.RevokedAt.Valid || !rt.ExpiresAt.After(time.Now()) {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	rt.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	db.refreshTokens[arg.Token] = rt
+	return rt, nil
+}
+
+func (db *memoryQueries) GetRefreshTokenIncludingRevoked(_ context.Context, token string) (database.RefreshToken, error) {
+	rt, ok := db.refreshTokens[token]
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return rt, nil
+}
+
+func (db *memoryQueries) RevokeRefreshTokenFamily(_ context.Context, arg database.RevokeRefreshTokenFamilyParams) (int64, error) {
+	var revoked int64
+	for token, rt := range db.refreshTokens {
+		if rt.FamilyID == arg.FamilyID && rt.UserID == arg.UserID && !rt.RevokedAt.Valid {
+			rt.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			db.refreshTokens[token] = rt
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func (db *memoryQueries) activeRefreshTokens() int {
+	count := 0
+	for _, rt := range db.refreshTokens {
+		if !rt.RevokedAt.Valid {
+			count++
+		}
+	}
+	return count
+}
+
+func newTestRefreshTokenConfig(tokens ...database.RefreshToken) (*apiConfig, *memoryQueries) {
+	db := newMemoryQueries()
+	for _, rt := range tokens {
+		db.refreshTokens[rt.Token] = rt
+	}
+	return &apiConfig{db: db}, db
+}
+
+func newTestRefreshToken(token string, validFor time.Duration) database.RefreshToken {
+	return database.RefreshToken{
+		Token:     token,
+		UserID:    uuid.New(),
+		FamilyID:  uuid.New(),
+		ExpiresAt: time.Now().Add(validFor),
+	}
+}
+
+func newTestOAuthRefreshToken(token string, clientID uuid.UUID) database.RefreshToken {
+	rt := newTestRefreshToken(token, time.Hour)
+	rt.ClientID = uuid.NullUUID{UUID: clientID, Valid: true}
+	rt.Scopes = []string{"chirps:read"}
+	return rt
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	partnerID := uuid.New()
+	testCases := map[string]struct {
+		stored        database.RefreshToken
+		presented     string
+		oauthClientID uuid.NullUUID
+		err           error
+	}{
+		"base case": {
+			stored:    newTestRefreshToken("xxx", time.Hour),
+			presented: "xxx",
+		},
+		"unknown token": {
+			stored:    newTestRefreshToken("xxx", time.Hour),
+			presented: "yyy",
+			err:       errRefreshTokenInvalid,
+		},
+		"expired token": {
+			stored:    newTestRefreshToken("xxx", -time.Hour),
+			presented: "xxx",
+			err:       errRefreshTokenInvalid,
+		},
+		"oauth client": {
+			stored:        newTestOAuthRefreshToken("xxx", partnerID),
+			presented:     "xxx",
+			oauthClientID: uuid.NullUUID{UUID: partnerID, Valid: true},
+		},
+		"oauth token refreshed as first party": {
+			stored:    newTestOAuthRefreshToken("xxx", partnerID),
+			presented: "xxx",
+			err:       errRefreshTokenInvalid,
+		},
+		"first party token refreshed by oauth client": {
+			stored:        newTestRefreshToken("xxx", time.Hour),
+			presented:     "xxx",
+			oauthClientID: uuid.NullUUID{UUID: partnerID, Valid: true},
+			err:           errRefreshTokenInvalid,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cfg, db := newTestRefreshTokenConfig(test.stored)
+			client := clientInfo{UserAgent: "bruno-runtime/1.0", IPAddress: "127.0.0.1"}
+			rt, err := cfg.rotateRefreshToken(context.Background(), test.presented, test.oauthClientID, client)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Unexpected error\nexpected: %v\ngot: %v", test.err, err)
+			}
+			if test.err != nil {
+				return
+			}
+			if rt.Token == test.stored.Token {
+				t.Fatalf("Refresh token was not rotated")
+			}
+			if rt.FamilyID != test.stored.FamilyID || rt.UserID != test.stored.UserID || rt.ClientID != test.stored.ClientID || !slices.Equal(rt.Scopes, test.stored.Scopes) {
+				t.Fatalf("Rotated token left its family %#v", rt)
+			}
+			if rt.UserAgent != client.UserAgent || rt.IpAddress != client.IPAddress {
+				t.Fatalf("Rotated token lost session metadata %#v", rt)
+			}
+			if !db.refreshTokens[test.stored.Token].RevokedAt.Valid {
+				t.Fatalf("Presented token was not revoked")
+			}
+		})
+	}
+}
+
+func TestRotateRefreshTokenReuse(t *testing.T) {
+	original := newTestRefreshToken("xxx", time.Hour)
+	unrelated := newTestRefreshToken("zzz", time.Hour)
+	cfg, db := newTestRefreshTokenConfig(original, unrelated)
+
+	rotated, err := cfg.rotateRefreshToken(context.Background(), original.Token, uuid.NullUUID{}, clientInfo{})
+	if err != nil {
+		t.Fatalf("First rotation failed with error %#v", err)
+	}
+	reused, err := cfg.rotateRefreshToken(context.Background(), original.Token, uuid.NullUUID{}, clientInfo{})
+	if !errors.Is(err, errRefreshTokenReused) {
+		t.Fatalf("Expected reuse detection, got %v", err)
+	}
+	if reused.UserID != original.UserID {
+		t.Fatalf("Reuse should report the token owner\nexpected: %v\ngot: %v", original.UserID, reused.UserID)
+	}
+	if !db.refreshTokens[rotated.Token].RevokedAt.Valid {
+		t.Fatalf("Reuse did not revoke the token family")
+	}
+	if _, err := cfg.rotateRefreshToken(context.Background(), rotated.Token, uuid.NullUUID{}, clientInfo{}); !errors.Is(err, errRefreshTokenReused) {
+		t.Fatalf("Expected revoked successor to be rejected, got %v", err)
+	}
+	if db.activeRefreshTokens() != 1 || db.refreshTokens[unrelated.Token].RevokedAt.Valid {
+		t.Fatalf("Reuse revoked tokens outside of its family")
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	defaultChirpMaxLength = 140
+	// chirpURLWeight is what any link costs, however long, so sharing one never eats
+	// the whole chirp.
+	chirpURLWeight = 23
+
+	zeroWidthJoiner    = '\u200d'
+	zeroWidthNonJoiner = '\u200c'
+	// Subdivision flags are a black flag followed by tag letters and a cancel tag.
+	blackFlag = '\U0001f3f4'
+	tagFirst  = '\U000e0020'
+	cancelTag = '\U000e007f'
+)
+
+// chirpWhitespace turns line endings into \n and tabs into spaces, they are the only
+// control characters a chirp may carry and must not be refused for the client's platform.
+var chirpWhitespace = strings.NewReplacer("\r\n", "\n", "\r", "\n", "\t", " ")
+
+var (
+	errChirpEmpty          = errors.New("Chirp is empty")
+	errChirpTooLong        = errors.New("Chirp is too long")
+	errChirpControlChar    = errors.New("Chirp contains control characters")
+	errChirpInvisibleChars = errors.New("Chirp contains invisible formatting characters")
+)
+
+// normalizeChirpBody returns the NFC form of body without its surrounding whitespace, so
+// the same text always looks and counts the same whatever the client sent.
+func normalizeChirpBody(body string) (string, error) {
+	if !utf8.ValidString(body) {
+		return "", errors.New("Chirp is not valid utf-8")
+	}
+	body = strings.TrimSpace(norm.NFC.String(chirpWhitespace.Replace(body)))
+	if body == "" {
+		return "", errChirpEmpty
+	}
+	runes := []rune(body)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r != '\n' && unicode.IsControl(r) {
+			return "", errChirpControlChar
+		}
+		if r == blackFlag {
+			i += tagSequenceLength(runes[i+1:])
+			continue
+		}
+		if !unicode.Is(unicode.Cf, r) {
+			continue
+		}
+		// Joiners are how emoji sequences and some scripts are written, they are only
+		// tolerated between two visible characters. Every other format character, bidi
+		// overrides included, can only be used to hide or disguise text.
+		if r != zeroWidthJoiner && r != zeroWidthNonJoiner {
+			return "", errChirpInvisibleChars
+		}
+		if i == 0 || i == len(runes)-1 || !isVisibleRune(runes[i-1]) || !isVisibleRune(runes[i+1]) {
+			return "", errChirpInvisibleChars
+		}
+	}
+	return body, nil
+}
+
+func isTagRune(r rune) bool {
+	return r >= tagFirst && r <= cancelTag
+}
+
+// tagSequenceLength is the number of runes of the tag sequence starting runes, tag
+// letters closed by a cancel tag, or 0 when there is none.
+func tagSequenceLength(runes []rune) int {
+	for i, r := range runes {
+		if r == cancelTag {
+			if i == 0 {
+				return 0
+			}
+			return i + 1
+		}
+		if !isTagRune(r) {
+			return 0
+		}
+	}
+	return 0
+}
+
+func isVisibleRune(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.Is(unicode.Cf, r)
+}
+
+func isChirpURL(word string) bool {
+	if !strings.HasPrefix(word, "http://") && !strings.HasPrefix(word, "https://") {
+		return false
+	}
+	u, err := url.Parse(word)
+	return err == nil && u.Host != ""
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= '\U0001f1e6' && r <= '\U0001f1ff'
+}
+
+func isEmojiModifier(r rune) bool {
+	return r >= '\U0001f3fb' && r <= '\U0001f3ff'
+}
+
+// graphemeLength approximates the number of user perceived characters: combining marks,
+// skin tones, tags, joiners and whatever follows a zero width joiner extend the previous
+// character, and regional indicators pair up into flags.
+func graphemeLength(text string) int {
+	length := 0
+	joined, openFlag := false, false
+	for _, r := range text {
+		extends := joined || r == zeroWidthJoiner || r == zeroWidthNonJoiner ||
+			unicode.In(r, unicode.Mn, unicode.Me) || isEmojiModifier(r) || isTagRune(r) ||
+			(openFlag && isRegionalIndicator(r))
+		if !extends {
+			length++
+		}
+		openFlag = !extends && isRegionalIndicator(r)
+		joined = r == zeroWidthJoiner
+	}
+	return length
+}
+
+// chirpLength counts characters the way readers see them, every url weighs chirpURLWeight.
+func chirpLength(body string) int {
+	length := graphemeLength(body)
+	for _, word := range strings.Fields(body) {
+		if isChirpURL(word) {
+			length += chirpURLWeight - graphemeLength(word)
+		}
+	}
+	return length
+}
+
+func validateChirpBody(body string, maxLength int) (string, error) {
+	body, err := normalizeChirpBody(body)
+	if err != nil {
+		return "", err
+	}
+	if chirpLength(body) > maxLength {
+		return "", fmt.Errorf("%w, the limit is %d characters", errChirpTooLong, maxLength)
+	}
+	return body, nil
+}
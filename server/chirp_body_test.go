@@ -0,0 +1,80 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// scotland is the black flag, the tags "gbsct" and a cancel tag.
+const scotland = "\U0001f3f4\U000e0067\U000e0062\U000e0073\U000e0063\U000e0074\U000e007f"
+
+func TestChirpLength(t *testing.T) {
+	testCases := map[string]struct {
+		body   string
+		length int
+	}{
+		"ascii":             {body: "Say my name", length: 11},
+		"accents":           {body: "Café crème", length: 10},
+		"combining accent":  {body: "Cafe\u0301", length: 4},
+		"emoji":             {body: "\U0001f9ea\U0001f52c", length: 2},
+		"skin tone":         {body: "\U0001f44b\U0001f3fd", length: 1},
+		"variation":         {body: "❤\ufe0f", length: 1},
+		"family sequence":   {body: "\U0001f468\u200d\U0001f469\u200d\U0001f467", length: 1},
+		"flags":             {body: "\U0001f1eb\U0001f1f7\U0001f1e9\U0001f1ea", length: 2},
+		"subdivision flag":  {body: scotland, length: 1},
+		"url":               {body: "https://example.com/" + strings.Repeat("a", 100), length: chirpURLWeight},
+		"text and url":      {body: "Read https://example.com/a", length: 5 + chirpURLWeight},
+		"not a url":         {body: "https://", length: 8},
+		"url without proto": {body: "example.com", length: 11},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if length := chirpLength(test.body); length != test.length {
+				t.Fatalf("Invalid length\nexpected: %d\ngot: %d", test.length, length)
+			}
+		})
+	}
+}
+
+func TestValidateChirpBody(t *testing.T) {
+	testCases := map[string]struct {
+		body     string
+		expected string
+		err      error
+	}{
+		"trimmed":             {body: "  Yeah, science!\n", expected: "Yeah, science!"},
+		"nfc":                 {body: "Cafe\u0301", expected: "Café"},
+		"newline":             {body: "Tread\nlightly", expected: "Tread\nlightly"},
+		"140 emoji":           {body: strings.Repeat("\U0001f9ea", 140), expected: strings.Repeat("\U0001f9ea", 140)},
+		"141 accents":         {body: strings.Repeat("é", 141), err: errChirpTooLong},
+		"long url":            {body: "https://example.com/" + strings.Repeat("a", 200), expected: "https://example.com/" + strings.Repeat("a", 200)},
+		"empty":               {body: " \t\n", err: errChirpEmpty},
+		"crlf":                {body: "Tread\r\nlightly\rnow", expected: "Tread\nlightly\nnow"},
+		"tab":                 {body: "Tread\tlightly", expected: "Tread lightly"},
+		"control":             {body: "Say\x00my name", err: errChirpControlChar},
+		"zero width space":    {body: "Say\u200bmy name", err: errChirpInvisibleChars},
+		"bidi override":       {body: "Say \u202emy name", err: errChirpInvisibleChars},
+		"leading joiner":      {body: "\u200dSay my name", err: errChirpInvisibleChars},
+		"stacked joiners":     {body: "a\u200d\u200db", err: errChirpInvisibleChars},
+		"joiner in emoji":     {body: "\U0001f468\u200d\U0001f469", expected: "\U0001f468\u200d\U0001f469"},
+		"non joiner in word":  {body: "می\u200cخواهم", expected: "می\u200cخواهم"},
+		"only invisible text": {body: "\u200b\u200b", err: errChirpInvisibleChars},
+		"subdivision flag":    {body: "Go " + scotland, expected: "Go " + scotland},
+		"unclosed tags":       {body: "\U0001f3f4\U000e0067\U000e0062", err: errChirpInvisibleChars},
+		"tags without flag":   {body: "Say\U000e0067\U000e007f my name", err: errChirpInvisibleChars},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			body, err := validateChirpBody(test.body, defaultChirpMaxLength)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Unexpected error\nexpected: %v\ngot: %v", test.err, err)
+			}
+			if body != test.expected {
+				t.Fatalf("Invalid body\nexpected: %q\ngot: %q", test.expected, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/auth"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+const (
+	chirpImportMaxBytes  = 10 << 20
+	chirpImportBatchSize = 500
+)
+
+var errUnsupportedImportFormat = errors.New("Import must be sent as application/x-ndjson or text/csv")
+
+type chirpImportRecord struct {
+	Line       int
+	ExternalID string
+	Body       string
+	CreatedAt  time.Time
+	Flagged    bool
+}
+
+type ChirpImportError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// derivedExternalID stands in for a missing external_id, a chirp always derives the same
+// id from its date and original body so uploading an archive again skips it.
+func derivedExternalID(createdAt time.Time, body string) string {
+	sum := sha256.Sum256([]byte(dbTime(createdAt).Format(time.RFC3339Nano) + "\n" + body))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// validateChirpImportRecord sanitizes the body the same way chirps created through the api are.
+func validateChirpImportRecord(record chirpImportRecord, now time.Time, policy chirpPolicy) (chirpImportRecord, error) {
+	if record.Body == "" {
+		return record, errors.New("Missing body")
+	}
+	if record.CreatedAt.IsZero() {
+		return record, errors.New("Missing created_at")
+	}
+	if record.CreatedAt.After(now) {
+		return record, errors.New("created_at is in the future")
+	}
+	if record.ExternalID == "" {
+		record.ExternalID = derivedExternalID(record.CreatedAt, record.Body)
+	}
+	body, flagged, err := sanitizeChirpBody(record.Body, policy)
+	if err != nil {
+		return record, err
+	}
+	record.Body = body
+	record.Flagged = flagged
+	record.CreatedAt = dbTime(record.CreatedAt)
+	return record, nil
+}
+
+func parseJSONLChirpImport(r io.Reader) ([]chirpImportRecord, []ChirpImportError, error) {
+	type line struct {
+		ExternalID string    `json:"external_id"`
+		Body       string    `json:"body"`
+		CreatedAt  time.Time `json:"created_at"`
+	}
+	records := []chirpImportRecord{}
+	lineErrors := []ChirpImportError{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		raw := strings.TrimSpace(scanner.Text())
+		if raw == "" {
+			continue
+		}
+		parsed := line{}
+		if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+			lineErrors = append(lineErrors, ChirpImportError{Line: n, Error: fmt.Sprintf("Invalid json %v", err)})
+			continue
+		}
+		records = append(records, chirpImportRecord{
+			Line:       n,
+			ExternalID: parsed.ExternalID,
+			Body:       parsed.Body,
+			CreatedAt:  parsed.CreatedAt,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return records, lineErrors, nil
+}
+
+// parseCSVChirpImport expects a header naming the body and created_at columns, external_id
+// is optional and unknown columns are ignored.
+func parseCSVChirpImport(r io.Reader) ([]chirpImportRecord, []ChirpImportError, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid csv header %v", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	for _, required := range []string{"body", "created_at"} {
+		if _, ok := columns[required]; !ok {
+			return nil, nil, fmt.Errorf("Missing %s column in csv header", required)
+		}
+	}
+	records := []chirpImportRecord{}
+	lineErrors := []ChirpImportError{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		parseErr := &csv.ParseError{}
+		if errors.As(err, &parseErr) {
+			lineErrors = append(lineErrors, ChirpImportError{Line: parseErr.StartLine, Error: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		record := chirpImportRecord{Line: line, Body: row[columns["body"]]}
+		if i, ok := columns["external_id"]; ok {
+			record.ExternalID = row[i]
+		}
+		if raw := row[columns["created_at"]]; raw != "" {
+			if record.CreatedAt, err = time.Parse(time.RFC3339, raw); err != nil {
+				lineErrors = append(lineErrors, ChirpImportError{Line: line, Error: fmt.Sprintf("Invalid created_at %q", raw)})
+				continue
+			}
+		}
+		records = append(records, record)
+	}
+	return records, lineErrors, nil
+}
+
+// parseChirpImport only fails when the archive as a whole cannot be read, problems with
+// single lines are reported next to the valid records.
+func parseChirpImport(r io.Reader, contentType string, now time.Time, policy chirpPolicy) ([]chirpImportRecord, []ChirpImportError, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	var records []chirpImportRecord
+	var lineErrors []ChirpImportError
+	var err error
+	switch mediaType {
+	case "application/x-ndjson", "application/jsonl":
+		records, lineErrors, err = parseJSONLChirpImport(r)
+	case "text/csv":
+		records, lineErrors, err = parseCSVChirpImport(r)
+	default:
+		return nil, nil, errUnsupportedImportFormat
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	valid := []chirpImportRecord{}
+	for _, record := range records {
+		record, err := validateChirpImportRecord(record, now, policy)
+		if err != nil {
+			lineErrors = append(lineErrors, ChirpImportError{Line: record.Line, Error: err.Error()})
+			continue
+		}
+		valid = append(valid, record)
+	}
+	slices.SortStableFunc(lineErrors, func(a, b ChirpImportError) int { return a.Line - b.Line })
+	return valid, lineErrors, nil
+}
+
+// importChirpBatch is all or nothing, so a failed upload can simply be sent again and the
+// external ids skip what earlier batches already imported.
+func importChirpBatch(ctx context.Context, cfg *apiConfig, userID uuid.UUID, batch []chirpImportRecord) (int, error) {
+	tx, err := cfg.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	queries := database.New(tx)
+	imported := 0
+	for _, record := range batch {
+		_, err := queries.ImportChirp(ctx, database.ImportChirpParams{
+			UserID:     userID,
+			Body:       record.Body,
+			CreatedAt:  record.CreatedAt,
+			ExternalID: sql.NullString{String: record.ExternalID, Valid: true},
+			Flagged:    record.Flagged,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("Failed importing line %d %v", record.Line, err)
+		}
+		imported++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return imported, nil
+}
+
+func getImportChirpsHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type responseBody struct {
+			Imported int                `json:"imported"`
+			Skipped  int                `json:"skipped"`
+			Errors   []ChirpImportError `json:"errors"`
+		}
+		uid, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		user, err := cfg.db.GetUserById(r.Context(), uid)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusUnauthorized, err)
+			return
+		}
+		if err := checkChirpAuthor(cfg, user); err != nil {
+			respondWithErrorJSON(w, http.StatusForbidden, err)
+			return
+		}
+		body := http.MaxBytesReader(w, r.Body, chirpImportMaxBytes)
+		records, lineErrors, err := parseChirpImport(body, r.Header.Get("Content-Type"), time.Now(), cfg.chirps)
+		if errors.Is(err, errUnsupportedImportFormat) {
+			respondWithErrorJSON(w, http.StatusUnsupportedMediaType, err)
+			return
+		}
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusBadRequest, err)
+			return
+		}
+		res := responseBody{Errors: lineErrors}
+		for batch := range slices.Chunk(records, chirpImportBatchSize) {
+			imported, err := importChirpBatch(r.Context(), cfg, uid, batch)
+			if err != nil {
+				respondWithErrorJSON(w, http.StatusInternalServerError, err)
+				return
+			}
+			res.Imported += imported
+			res.Skipped += len(batch) - imported
+		}
+		respondWithJSON(w, http.StatusOK, res)
+	})
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/the-1aw/chirpy/internal/profanity"
+)
+
+func TestParseChirpImport(t *testing.T) {
+	now := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	testCases := map[string]struct {
+		contentType string
+		archive     string
+		bodies      []string
+		errorLines  []int
+		err         error
+	}{
+		"jsonl": {
+			contentType: "application/x-ndjson",
+			archive: `{"external_id": "1", "body": "I'm the one who knocks!", "created_at": "2024-01-01T10:00:00Z"}
+
+{"external_id": "2", "body": "What a kerfuffle", "created_at": "2024-01-02T10:00:00+02:00"}`,
+			bodies: []string{"I'm the one who knocks!", "What a ****"},
+		},
+		"jsonl line errors": {
+			contentType: "application/jsonl; charset=utf-8",
+			archive: `{"body": "Say my name", "created_at": "2024-01-01T10:00:00Z"}
+not json
+{"body": "", "created_at": "2024-01-01T10:00:00Z"}
+{"body": "From the future", "created_at": "2030-01-01T10:00:00Z"}
+{"body": "No date"}`,
+			bodies:     []string{"Say my name"},
+			errorLines: []int{2, 3, 4, 5},
+		},
+		"csv": {
+			contentType: "text/csv",
+			archive: `external_id,created_at,body,likes
+a,2024-01-01T10:00:00Z,"Yeah, science!",3
+b,2024-01-03T10:00:00Z,Sharbert,0`,
+			bodies: []string{"Yeah, science!", "****"},
+		},
+		"csv line errors": {
+			contentType: "text/csv",
+			archive: `body,created_at
+Tread lightly,yesterday
+` + strings.Repeat("a", 141) + `,2024-01-01T10:00:00Z
+Stay out of my territory,2024-01-01T10:00:00Z`,
+			bodies:     []string{"Stay out of my territory"},
+			errorLines: []int{2, 3},
+		},
+		"csv missing column": {
+			contentType: "text/csv",
+			archive:     "external_id,body\n1,hello",
+			err:         errors.New("Missing created_at column in csv header"),
+		},
+		"unsupported format": {
+			contentType: "application/json",
+			archive:     "[]",
+			err:         errUnsupportedImportFormat,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			records, lineErrors, err := parseChirpImport(strings.NewReader(test.archive), test.contentType, now, chirpPolicy{
+				maxLength: defaultChirpMaxLength,
+				profanity: profanity.NewFilter([]string{"kerfuffle", "sharbert"}),
+			})
+			if test.err != nil {
+				if err == nil || err.Error() != test.err.Error() {
+					t.Fatalf("Unexpected error\nexpected: %v\ngot: %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			bodies := []string{}
+			for _, record := range records {
+				bodies = append(bodies, record.Body)
+			}
+			if !slices.Equal(bodies, test.bodies) {
+				t.Fatalf("Invalid records\nexpected: %v\ngot: %v", test.bodies, bodies)
+			}
+			errorLines := []int{}
+			for _, lineError := range lineErrors {
+				errorLines = append(errorLines, lineError.Line)
+			}
+			if !slices.Equal(errorLines, test.errorLines) {
+				t.Fatalf("Invalid line errors\nexpected: %v\ngot: %v", test.errorLines, lineErrors)
+			}
+		})
+	}
+}
+
+func TestParseChirpImportTwice(t *testing.T) {
+	now := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	archive := `{"external_id": "1", "body": "Say my name", "created_at": "2024-01-01T10:00:00Z"}
+{"body": "Say my name", "created_at": "2024-01-01T10:00:00Z"}
+{"body": "Say my name", "created_at": "2024-01-01T12:00:00+02:00"}
+{"body": "Tread lightly", "created_at": "2024-01-01T10:00:00Z"}`
+	policy := chirpPolicy{maxLength: defaultChirpMaxLength, profanity: profanity.NewFilter(nil)}
+	parse := func() []string {
+		records, lineErrors, err := parseChirpImport(strings.NewReader(archive), "application/x-ndjson", now, policy)
+		if err != nil || len(lineErrors) != 0 {
+			t.Fatalf("Unexpected errors %v %v", err, lineErrors)
+		}
+		ids := []string{}
+		for _, record := range records {
+			ids = append(ids, record.ExternalID)
+		}
+		return ids
+	}
+
+	first, second := parse(), parse()
+	if !slices.Equal(first, second) {
+		t.Fatalf("Importing the same archive again should derive the same ids\nfirst: %v\nsecond: %v", first, second)
+	}
+	if first[0] != "1" {
+		t.Fatalf("Provided external ids should be kept, got %q", first[0])
+	}
+	if first[1] == "" || first[1] != first[2] {
+		t.Fatalf("The same chirp should derive the same id whatever its zone %v", first)
+	}
+	if first[1] == first[3] {
+		t.Fatalf("Different chirps should derive different ids %v", first)
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/auth"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+type ChirpLike struct {
+	UserID  uuid.UUID `json:"user_id"`
+	LikedAt time.Time `json:"liked_at"`
+}
+
+// requestViewer is the caller allowed to read chirps, uuid.Nil for anonymous callers and
+// invalid tokens since reading chirps never requires authentication.
+func (cfg *apiConfig) requestViewer(r *http.Request) uuid.UUID {
+	uid, err := cfg.authenticate(r, auth.ScopeChirpsRead)
+	if err != nil {
+		return uuid.Nil
+	}
+	return uid
+}
+
+func chirpRefs(chirps []Chirp) []*Chirp {
+	refs := make([]*Chirp, 0, len(chirps))
+	for i := range chirps {
+		refs = append(refs, &chirps[i])
+	}
+	return refs
+}
+
+// setLikedByMe fills liked_by_me with one query for the whole page, anonymous callers
+// don't get the field at all.
+func (cfg *apiConfig) setLikedByMe(r *http.Request, chirps ...*Chirp) error {
+	uid := cfg.requestViewer(r)
+	if uid == uuid.Nil || len(chirps) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+	liked, err := cfg.db.GetLikedChirpIDs(r.Context(), database.GetLikedChirpIDsParams{UserID: uid, ChirpIds: ids})
+	if err != nil {
+		return err
+	}
+	for _, chirp := range chirps {
+		likedByMe := slices.Contains(liked, chirp.ID)
+		chirp.LikedByMe = &likedByMe
+	}
+	return nil
+}
+
+// getLikeChirpHandler handles both POST and DELETE, liking or unliking twice is not an error.
+func getLikeChirpHandler(cfg *apiConfig, like bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		uid, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		if _, err := cfg.db.GetChirpById(r.Context(), chirpID); err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		if like {
+			_, err = cfg.db.LikeChirp(r.Context(), database.LikeChirpParams{UserID: uid, ChirpID: chirpID})
+		} else {
+			_, err = cfg.db.UnlikeChirp(r.Context(), database.UnlikeChirpParams{UserID: uid, ChirpID: chirpID})
+		}
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// getGetChirpLikesHandler lists who liked a chirp newest first, with the limit and cursor
+// params of the chirps listing.
+func getGetChirpLikesHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		limit, cursor, err := parsePageParams(r.URL.Query())
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusBadRequest, err)
+			return
+		}
+		if _, err := cfg.db.GetChirpById(r.Context(), chirpID); err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		params := database.GetChirpLikesParams{ChirpID: chirpID, MaxResults: int32(limit + 1)}
+		if cursor != nil {
+			params.CursorCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+			params.CursorUserID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
+		}
+		rows, err := cfg.db.GetChirpLikes(r.Context(), params)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if len(rows) > limit {
+			rows = rows[:limit]
+			last := rows[len(rows)-1]
+			next := chirpCursor{CreatedAt: last.CreatedAt, ID: last.UserID}
+			w.Header().Set("Link", nextChirpPageLink(cfg, r, next.encode()))
+		}
+		likes := []ChirpLike{}
+		for _, row := range rows {
+			likes = append(likes, ChirpLike{UserID: row.UserID, LikedAt: row.CreatedAt})
+		}
+		respondWithJSON(w, http.StatusOK, likes)
+	})
+}
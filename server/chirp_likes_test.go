@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/auth"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+func (db *memoryQueries) GetChirpById(_ context.Context, id uuid.UUID) (database.Chirp, error) {
+	chirp, ok := db.chirps[id]
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return chirp, nil
+}
+
+func (db *memoryQueries) LikeChirp(_ context.Context, arg database.LikeChirpParams) (int64, error) {
+	if db.likes[arg] {
+		return 0, nil
+	}
+	db.likes[arg] = true
+	return 1, nil
+}
+
+func (db *memoryQueries) UnlikeChirp(_ context.Context, arg database.UnlikeChirpParams) (int64, error) {
+	like := database.LikeChirpParams(arg)
+	if !db.likes[like] {
+		return 0, nil
+	}
+	delete(db.likes, like)
+	return 1, nil
+}
+
+func (db *memoryQueries) GetLikedChirpIDs(_ context.Context, arg database.GetLikedChirpIDsParams) ([]uuid.UUID, error) {
+	liked := []uuid.UUID{}
+	for _, id := range arg.ChirpIds {
+		if db.likes[database.LikeChirpParams{UserID: arg.UserID, ChirpID: id}] {
+			liked = append(liked, id)
+		}
+	}
+	return liked, nil
+}
+
+func TestLikeChirp(t *testing.T) {
+	keys := auth.NewHMACKeySet("validSecret")
+	uid := uuid.New()
+	token, err := keys.MakeJWT(uid, auth.RoleUser, time.Hour)
+	if err != nil {
+		t.Fatal("Failed due to make jwt (improper test case setup)")
+	}
+	testCases := map[string]struct {
+		likedBefore   bool
+		requests      []bool
+		anonymous     bool
+		unknownChirp  bool
+		status        int
+		expectedLiked bool
+	}{
+		"like":             {requests: []bool{true}, status: http.StatusNoContent, expectedLiked: true},
+		"like twice":       {requests: []bool{true, true}, status: http.StatusNoContent, expectedLiked: true},
+		"unlike":           {likedBefore: true, requests: []bool{false}, status: http.StatusNoContent},
+		"unlike twice":     {likedBefore: true, requests: []bool{false, false}, status: http.StatusNoContent},
+		"unlike not liked": {requests: []bool{false}, status: http.StatusNoContent},
+		"anonymous":        {requests: []bool{true}, anonymous: true, status: http.StatusUnauthorized},
+		"unknown chirp":    {requests: []bool{true}, unknownChirp: true, status: http.StatusNotFound},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			chirp := database.Chirp{ID: uuid.New(), Body: "Say my name"}
+			db := newMemoryQueries()
+			db.chirps[chirp.ID] = chirp
+			like := database.LikeChirpParams{UserID: uid, ChirpID: chirp.ID}
+			if test.likedBefore {
+				db.likes[like] = true
+			}
+			cfg := &apiConfig{db: db, keys: keys}
+			chirpID := chirp.ID
+			if test.unknownChirp {
+				chirpID = uuid.New()
+			}
+			for _, liking := range test.requests {
+				method := http.MethodPost
+				if !liking {
+					method = http.MethodDelete
+				}
+				req := httptest.NewRequest(method, "/api/chirps/"+chirpID.String()+"/like", nil)
+				req.SetPathValue("chirpID", chirpID.String())
+				if !test.anonymous {
+					req.Header.Set("Authorization", "Bearer "+token)
+				}
+				rec := httptest.NewRecorder()
+				getLikeChirpHandler(cfg, liking).ServeHTTP(rec, req)
+				if rec.Code != test.status {
+					t.Fatalf("Unexpected status\nexpected: %d\ngot: %d %s", test.status, rec.Code, rec.Body.String())
+				}
+			}
+			if db.likes[like] != test.expectedLiked || len(db.likes) > 1 {
+				t.Fatalf("Invalid likes\nexpected liked: %v\ngot: %v", test.expectedLiked, db.likes)
+			}
+		})
+	}
+}
+
+func TestSetLikedByMe(t *testing.T) {
+	db := newMemoryQueries()
+	cfg := &apiConfig{db: db, keys: auth.NewHMACKeySet("validSecret")}
+	uid := uuid.New()
+	token, err := cfg.keys.MakeJWT(uid, auth.RoleUser, time.Hour)
+	if err != nil {
+		t.Fatal("Failed due to make jwt (improper test case setup)")
+	}
+	liked := database.Chirp{ID: uuid.New()}
+	notLiked := database.Chirp{ID: uuid.New()}
+	db.likes[database.LikeChirpParams{UserID: uid, ChirpID: liked.ID}] = true
+	db.likes[database.LikeChirpParams{UserID: uuid.New(), ChirpID: notLiked.ID}] = true
+	testCases := map[string]struct {
+		authorization string
+		// expected is nil when liked_by_me must be left out.
+		expected []bool
+	}{
+		"authenticated": {authorization: "Bearer " + token, expected: []bool{true, false}},
+		"anonymous":     {authorization: ""},
+		"invalid token": {authorization: "Bearer xxx"},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			chirps := []Chirp{fromDbChirp(liked), fromDbChirp(notLiked)}
+			if err := cfg.setLikedByMe(req, chirpRefs(chirps)...); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if test.expected == nil {
+				if chirps[0].LikedByMe != nil || chirps[1].LikedByMe != nil {
+					t.Fatalf("liked_by_me should be left out for anonymous callers")
+				}
+				return
+			}
+			got := []bool{}
+			for _, chirp := range chirps {
+				if chirp.LikedByMe == nil {
+					t.Fatalf("liked_by_me should be set for %v", chirp.ID)
+				}
+				got = append(got, *chirp.LikedByMe)
+			}
+			if !slices.Equal(got, test.expected) {
+				t.Fatalf("Invalid liked_by_me\nexpected: %v\ngot: %v", test.expected, got)
+			}
+		})
+	}
+}
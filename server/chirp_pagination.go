@@ -0,0 +1,148 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+const (
+	defaultChirpPageSize = 50
+	maxChirpPageSize     = 100
+)
+
+var errInvalidCursor = errors.New("Invalid cursor")
+
+// chirpCursor is the position of the last chirp of a page, clients only get it
+// base64 encoded so its content can change without breaking them.
+type chirpCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+	// Rank is only set on search cursors, results are ordered by relevance first.
+	Rank *float32 `json:"r,omitempty"`
+}
+
+func (c chirpCursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func encodeChirpCursor(chirp database.Chirp) string {
+	return chirpCursor{CreatedAt: chirp.CreatedAt, ID: chirp.ID}.encode()
+}
+
+func decodeChirpCursor(cursor string) (chirpCursor, error) {
+	c := chirpCursor{}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID == uuid.Nil || c.CreatedAt.IsZero() {
+		return chirpCursor{}, errInvalidCursor
+	}
+	return c, nil
+}
+
+type chirpPageQuery struct {
+	authorID uuid.NullUUID
+	sort     string
+	limit    int
+	cursor   *chirpCursor
+}
+
+// parseChirpPageQuery reads the author_id, sort, limit and cursor params of GET /api/chirps.
+func parseChirpPageQuery(query url.Values) (chirpPageQuery, error) {
+	page := chirpPageQuery{sort: sortOrderAsc, limit: defaultChirpPageSize}
+	if authorID := query.Get("author_id"); authorID != "" {
+		uid, err := uuid.Parse(authorID)
+		if err != nil {
+			return page, fmt.Errorf("Invalid author_id %s", authorID)
+		}
+		page.authorID = uuid.NullUUID{UUID: uid, Valid: true}
+	}
+	if sort := query.Get("sort"); sort != "" {
+		if sort != sortOrderAsc && sort != sortOrderDesc {
+			return page, fmt.Errorf("Invalid sort %s must be %s or %s", sort, sortOrderAsc, sortOrderDesc)
+		}
+		page.sort = sort
+	}
+	limit, cursor, err := parsePageParams(query)
+	if err != nil {
+		return page, err
+	}
+	page.limit = limit
+	page.cursor = cursor
+	return page, nil
+}
+
+// parsePageParams reads the limit and cursor params shared by every paginated listing.
+func parsePageParams(query url.Values) (int, *chirpCursor, error) {
+	limit := defaultChirpPageSize
+	if raw := query.Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > maxChirpPageSize {
+			return 0, nil, fmt.Errorf("Invalid limit %s must be between 1 and %d", raw, maxChirpPageSize)
+		}
+	}
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := decodeChirpCursor(raw)
+		if err != nil {
+			return 0, nil, err
+		}
+		return limit, &cursor, nil
+	}
+	return limit, nil, nil
+}
+
+// fetch asks for one chirp more than the limit to know whether a next page exists
+// without counting, the cursor is empty on the last page.
+func (page chirpPageQuery) fetch(cfg *apiConfig, r *http.Request) ([]database.Chirp, string, error) {
+	cursorCreatedAt := sql.NullTime{}
+	cursorID := uuid.NullUUID{}
+	if page.cursor != nil {
+		cursorCreatedAt = sql.NullTime{Time: page.cursor.CreatedAt, Valid: true}
+		cursorID = uuid.NullUUID{UUID: page.cursor.ID, Valid: true}
+	}
+	var chirps []database.Chirp
+	var err error
+	if page.sort == sortOrderDesc {
+		chirps, err = cfg.db.GetChirpsPageDesc(r.Context(), database.GetChirpsPageDescParams{
+			AuthorID:        page.authorID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			MaxResults:      int32(page.limit + 1),
+		})
+	} else {
+		chirps, err = cfg.db.GetChirpsPageAsc(r.Context(), database.GetChirpsPageAscParams{
+			AuthorID:        page.authorID,
+			CursorCreatedAt: cursorCreatedAt,
+			CursorID:        cursorID,
+			MaxResults:      int32(page.limit + 1),
+		})
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if len(chirps) <= page.limit {
+		return chirps, "", nil
+	}
+	chirps = chirps[:page.limit]
+	return chirps, encodeChirpCursor(chirps[len(chirps)-1]), nil
+}
+
+// nextChirpPageLink keeps the filters of the current request and only swaps the cursor.
+func nextChirpPageLink(cfg *apiConfig, r *http.Request, cursor string) string {
+	query := r.URL.Query()
+	query.Set("cursor", cursor)
+	return fmt.Sprintf("<%s%s?%s>; rel=\"next\"", cfg.publicURL, r.URL.Path, query.Encode())
+}
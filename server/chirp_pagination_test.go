@@ -0,0 +1,79 @@
+package server
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+func TestChirpCursor(t *testing.T) {
+	chirp := database.Chirp{
+		ID:        uuid.New(),
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC),
+	}
+	cursor, err := decodeChirpCursor(encodeChirpCursor(chirp))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if cursor.ID != chirp.ID || !cursor.CreatedAt.Equal(chirp.CreatedAt) {
+		t.Fatalf("Invalid cursor\nexpected: %v %v\ngot: %v %v", chirp.CreatedAt, chirp.ID, cursor.CreatedAt, cursor.ID)
+	}
+	for _, invalid := range []string{"not base64!", "bm90IGpzb24", "e30"} {
+		if _, err := decodeChirpCursor(invalid); err != errInvalidCursor {
+			t.Fatalf("Cursor %q should be refused, got %v", invalid, err)
+		}
+	}
+}
+
+func TestParseChirpPageQuery(t *testing.T) {
+	authorID := uuid.New()
+	cursor := encodeChirpCursor(database.Chirp{ID: uuid.New(), CreatedAt: time.Now()})
+	testCases := map[string]struct {
+		query     string
+		sort      string
+		limit     int
+		hasAuthor bool
+		hasCursor bool
+		err       bool
+	}{
+		"defaults":       {query: "", sort: sortOrderAsc, limit: defaultChirpPageSize},
+		"desc":           {query: "sort=desc", sort: sortOrderDesc, limit: defaultChirpPageSize},
+		"limit":          {query: "limit=10", sort: sortOrderAsc, limit: 10},
+		"author":         {query: "author_id=" + authorID.String(), sort: sortOrderAsc, limit: defaultChirpPageSize, hasAuthor: true},
+		"cursor":         {query: "cursor=" + cursor, sort: sortOrderAsc, limit: defaultChirpPageSize, hasCursor: true},
+		"invalid sort":   {query: "sort=random", err: true},
+		"zero limit":     {query: "limit=0", err: true},
+		"huge limit":     {query: "limit=1000", err: true},
+		"invalid limit":  {query: "limit=ten", err: true},
+		"invalid author": {query: "author_id=heisenberg", err: true},
+		"invalid cursor": {query: "cursor=heisenberg", err: true},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			query, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatalf("Invalid test query %v", err)
+			}
+			page, err := parseChirpPageQuery(query)
+			if test.err {
+				if err == nil {
+					t.Fatalf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if page.sort != test.sort || page.limit != test.limit {
+				t.Fatalf("Invalid page\nexpected: %s %d\ngot: %s %d", test.sort, test.limit, page.sort, page.limit)
+			}
+			if page.authorID.Valid != test.hasAuthor || (page.cursor != nil) != test.hasCursor {
+				t.Fatalf("Invalid filters %+v", page)
+			}
+		})
+	}
+}
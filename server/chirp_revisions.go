@@ -0,0 +1,151 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/auth"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+const defaultChirpEditWindow = time.Hour
+
+var errChirpEditWindowClosed = errors.New("Chirp can no longer be edited, upgrade to Chirpy Red to edit older chirps")
+
+type ChirpRevision struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+	Body       string    `json:"body"`
+}
+
+func fromDbChirpRevision(revision database.ChirpRevision) ChirpRevision {
+	return ChirpRevision{
+		ID:         revision.ID,
+		CreatedAt:  revision.CreatedAt,
+		ReplacedAt: revision.ReplacedAt,
+		Body:       revision.Body,
+	}
+}
+
+// checkChirpEditWindow counts from the first publication so repeated edits don't extend the window.
+func checkChirpEditWindow(chirp database.Chirp, author database.User, window time.Duration, now time.Time) error {
+	if author.IsChirpyRed || now.Before(chirp.CreatedAt.Add(window)) {
+		return nil
+	}
+	return errChirpEditWindowClosed
+}
+
+// editChirp keeps the replaced body as a revision in the same transaction as the edit.
+func editChirp(cfg *apiConfig, r *http.Request, params database.UpdateChirpBodyParams) (database.Chirp, error) {
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	defer tx.Rollback()
+	queries := database.New(tx)
+	if _, err := queries.CreateChirpRevision(r.Context(), params.ID); err != nil {
+		return database.Chirp{}, err
+	}
+	chirp, err := queries.UpdateChirpBody(r.Context(), params)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	return chirp, tx.Commit()
+}
+
+func getUpdateChirpHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type requestBody struct {
+			Body string `json:"body"`
+		}
+		chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusBadRequest, err)
+			return
+		}
+		uid, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		user, err := cfg.db.GetUserById(r.Context(), uid)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusUnauthorized, err)
+			return
+		}
+		if err := checkChirpAuthor(cfg, user); err != nil {
+			respondWithErrorJSON(w, http.StatusForbidden, err)
+			return
+		}
+		decoder := json.NewDecoder(r.Body)
+		req := requestBody{}
+		if err := decoder.Decode(&req); err != nil {
+			respondWithErrorJSON(w, http.StatusBadRequest, fmt.Errorf("Bad request %v", err))
+			return
+		}
+		chirp, err := cfg.db.GetChirpByIdIncludingFlagged(r.Context(), chirpID)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		if chirp.UserID.UUID != uid {
+			respondWithErrorJSON(w, http.StatusForbidden, fmt.Errorf("Forbidden"))
+			return
+		}
+		if err := checkChirpEditWindow(chirp, user, cfg.chirps.editWindow, time.Now()); err != nil {
+			respondWithErrorJSON(w, http.StatusForbidden, err)
+			return
+		}
+		chirpBody, flagged, err := sanitizeChirpBody(req.Body, cfg.chirps)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusBadRequest, err)
+			return
+		}
+		if chirpBody == chirp.Body {
+			respondWithJSON(w, http.StatusOK, fromDbChirp(chirp))
+			return
+		}
+		chirp, err = editChirp(cfg, r, database.UpdateChirpBodyParams{
+			ID:      chirpID,
+			UserID:  uid,
+			Body:    chirpBody,
+			Flagged: flagged,
+		})
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, fromDbChirp(chirp))
+	})
+}
+
+// getGetChirpRevisionsHandler lists the replaced bodies newest first, the current one is the chirp itself.
+func getGetChirpRevisionsHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		// Revisions of hidden chirps stay hidden too.
+		if _, err := cfg.db.GetChirpById(r.Context(), chirpID); err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		revisionsFromDb, err := cfg.db.GetChirpRevisions(r.Context(), chirpID)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		revisions := []ChirpRevision{}
+		for _, revision := range revisionsFromDb {
+			revisions = append(revisions, fromDbChirpRevision(revision))
+		}
+		respondWithJSON(w, http.StatusOK, revisions)
+	})
+}
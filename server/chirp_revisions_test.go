@@ -0,0 +1,32 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+func TestCheckChirpEditWindow(t *testing.T) {
+	now := time.Now()
+	testCases := map[string]struct {
+		age       time.Duration
+		chirpyRed bool
+		err       error
+	}{
+		"fresh":             {age: time.Minute},
+		"window closed":     {age: 2 * time.Hour, err: errChirpEditWindowClosed},
+		"window boundary":   {age: defaultChirpEditWindow, err: errChirpEditWindowClosed},
+		"chirpy red member": {age: 24 * 365 * time.Hour, chirpyRed: true},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			chirp := database.Chirp{CreatedAt: now.Add(-test.age)}
+			author := database.User{IsChirpyRed: test.chirpyRed}
+			if err := checkChirpEditWindow(chirp, author, defaultChirpEditWindow, now); err != test.err {
+				t.Fatalf("Unexpected error\nexpected: %v\ngot: %v", test.err, err)
+			}
+		})
+	}
+}
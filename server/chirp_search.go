@@ -0,0 +1,187 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+const (
+	maxSearchQueryLength = 256
+	// The snippet markers can't appear in chirps since control characters are refused,
+	// they are swapped for <mark> tags once the snippet is escaped.
+	snippetStart = "\x02"
+	snippetStop  = "\x03"
+)
+
+var (
+	snippetOptions = fmt.Sprintf("StartSel=%s, StopSel=%s, MinWords=5, MaxWords=20", snippetStart, snippetStop)
+
+	errEmptySearch   = errors.New("Search query must contain at least one word")
+	errSearchTooLong = fmt.Errorf("Search query must be at most %d characters", maxSearchQueryLength)
+	errSearchSort    = errors.New("Search results are sorted by relevance, sort is not supported")
+)
+
+type ChirpSearchResult struct {
+	Chirp
+	Rank float32 `json:"rank"`
+	// Snippet is html escaped, matched words are wrapped in <mark> tags.
+	Snippet string `json:"snippet"`
+}
+
+func fromDbChirpSearchResult(row database.SearchChirpsRow) ChirpSearchResult {
+	return ChirpSearchResult{
+		Chirp: fromDbChirp(database.Chirp{
+			ID:         row.ID,
+			UserID:     row.UserID,
+			CreatedAt:  row.CreatedAt,
+			UpdatedAt:  row.UpdatedAt,
+			Body:       row.Body,
+			EditedAt:   row.EditedAt,
+			ReplyToID:  row.ReplyToID,
+			ReplyCount: row.ReplyCount,
+			LikeCount:  row.LikeCount,
+		}),
+		Rank:    row.Rank,
+		Snippet: highlightSnippet(row.Snippet),
+	}
+}
+
+func highlightSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, snippetStart, "<mark>")
+	return strings.ReplaceAll(snippet, snippetStop, "</mark>")
+}
+
+// buildSearchQuery turns q into a to_tsquery expression. Words are all required,
+// "quoted words" must follow each other, a trailing * matches any word starting with
+// the prefix, a leading - excludes a word and OR accepts either side.
+// Only letters and digits reach postgres, everything else separates words.
+func buildSearchQuery(q string) (string, error) {
+	if utf8.RuneCountInString(q) > maxSearchQueryLength {
+		return "", errSearchTooLong
+	}
+	b := strings.Builder{}
+	pendingOr := false
+	rest := strings.TrimSpace(q)
+	for rest != "" {
+		negated := strings.HasPrefix(rest, "-")
+		if negated {
+			rest = rest[1:]
+		}
+		var raw string
+		phrase := strings.HasPrefix(rest, `"`)
+		if phrase {
+			raw, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			raw, rest = rest[:end], rest[end:]
+		}
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+		if raw == "OR" && !phrase && !negated {
+			pendingOr = b.Len() > 0
+			continue
+		}
+		words := strings.FieldsFunc(raw, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if len(words) == 0 {
+			continue
+		}
+		if !phrase && strings.HasSuffix(raw, "*") {
+			words[len(words)-1] += ":*"
+		}
+		term := strings.Join(words, " <-> ")
+		if len(words) > 1 {
+			term = "(" + term + ")"
+		}
+		if negated {
+			term = "!" + term
+		}
+		if b.Len() > 0 {
+			if pendingOr {
+				b.WriteString(" | ")
+			} else {
+				b.WriteString(" & ")
+			}
+		}
+		pendingOr = false
+		b.WriteString(term)
+	}
+	if b.Len() == 0 {
+		return "", errEmptySearch
+	}
+	return b.String(), nil
+}
+
+// getSearchChirpsHandler takes the author_id, limit and cursor params of the chirps
+// listing, pages are ordered by relevance then newest first.
+func getSearchChirpsHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		tsQuery, err := buildSearchQuery(query.Get("q"))
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusBadRequest, err)
+			return
+		}
+		if query.Has("sort") {
+			respondWithErrorJSON(w, http.StatusBadRequest, errSearchSort)
+			return
+		}
+		page, err := parseChirpPageQuery(query)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusBadRequest, err)
+			return
+		}
+		params := database.SearchChirpsParams{
+			Query:           tsQuery,
+			HeadlineOptions: snippetOptions,
+			AuthorID:        page.authorID,
+			MaxResults:      int32(page.limit + 1),
+		}
+		if page.cursor != nil {
+			if page.cursor.Rank == nil {
+				respondWithErrorJSON(w, http.StatusBadRequest, errInvalidCursor)
+				return
+			}
+			params.CursorRank = sql.NullFloat64{Float64: float64(*page.cursor.Rank), Valid: true}
+			params.CursorCreatedAt = sql.NullTime{Time: page.cursor.CreatedAt, Valid: true}
+			params.CursorID = uuid.NullUUID{UUID: page.cursor.ID, Valid: true}
+		}
+		rows, err := cfg.db.SearchChirps(r.Context(), params)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if len(rows) > page.limit {
+			rows = rows[:page.limit]
+			last := rows[len(rows)-1]
+			cursor := chirpCursor{CreatedAt: last.CreatedAt, ID: last.ID, Rank: &last.Rank}
+			w.Header().Set("Link", nextChirpPageLink(cfg, r, cursor.encode()))
+		}
+		results := []ChirpSearchResult{}
+		for _, row := range rows {
+			results = append(results, fromDbChirpSearchResult(row))
+		}
+		refs := []*Chirp{}
+		for i := range results {
+			refs = append(refs, &results[i].Chirp)
+		}
+		if err := cfg.setLikedByMe(r, refs...); err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, results)
+	})
+}
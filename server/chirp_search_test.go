@@ -0,0 +1,51 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildSearchQuery(t *testing.T) {
+	testCases := map[string]struct {
+		q        string
+		expected string
+		err      error
+	}{
+		"words":             {q: "blue crystal", expected: "blue & crystal"},
+		"phrase":            {q: `"say my name"`, expected: "(say <-> my <-> name)"},
+		"prefix":            {q: "heisen*", expected: "heisen:*"},
+		"excluded":          {q: "cook -meth", expected: "cook & !meth"},
+		"excluded phrase":   {q: `chicken -"los pollos"`, expected: `chicken & !(los <-> pollos)`},
+		"or":                {q: "walter OR jesse", expected: "walter | jesse"},
+		"leading or":        {q: "OR jesse", expected: "jesse"},
+		"lowercase or":      {q: "walter or jesse", expected: "walter & or & jesse"},
+		"punctuation":       {q: "don't", expected: "(don <-> t)"},
+		"operators dropped": {q: "a&b | !c ' <-> :*", expected: "(a <-> b) & c"},
+		"prefix on split":   {q: "e-mail*", expected: "(e <-> mail:*)"},
+		"unclosed phrase":   {q: `"tread lightly`, expected: "(tread <-> lightly)"},
+		"accents":           {q: "café", expected: "café"},
+		"empty":             {q: "  ", err: errEmptySearch},
+		"only symbols":      {q: `"" - *`, err: errEmptySearch},
+		"too long":          {q: strings.Repeat("a", maxSearchQueryLength+1), err: errSearchTooLong},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			query, err := buildSearchQuery(test.q)
+			if err != test.err {
+				t.Fatalf("Unexpected error\nexpected: %v\ngot: %v", test.err, err)
+			}
+			if query != test.expected {
+				t.Fatalf("Invalid query\nexpected: %q\ngot: %q", test.expected, query)
+			}
+		})
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	snippet := highlightSnippet("I am the " + snippetStart + "danger" + snippetStop + " <script>")
+	expected := "I am the <mark>danger</mark> &lt;script&gt;"
+	if snippet != expected {
+		t.Fatalf("Invalid snippet\nexpected: %q\ngot: %q", expected, snippet)
+	}
+}
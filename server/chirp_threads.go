@@ -0,0 +1,194 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+const (
+	defaultChirpThreadDepth = 3
+	maxChirpThreadDepth     = 10
+	maxChirpAncestors       = 100
+	maxChirpThreadReplies   = 500
+)
+
+var errReplyToMissing = errors.New("Chirp to reply to does not exist")
+
+type ChirpThreadNode struct {
+	Chirp
+	Replies []*ChirpThreadNode `json:"replies"`
+}
+
+type ChirpThread struct {
+	// Ancestors go from the root of the conversation down to the parent of Chirp.
+	Ancestors []Chirp          `json:"ancestors"`
+	Chirp     *ChirpThreadNode `json:"chirp"`
+}
+
+// chirpRefs lists every chirp of the thread, ancestors first then the tree breadth first.
+func (thread *ChirpThread) chirpRefs() []*Chirp {
+	refs := chirpRefs(thread.Ancestors)
+	queue := []*ChirpThreadNode{thread.Chirp}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = append(queue[1:], node.Replies...)
+		refs = append(refs, &node.Chirp)
+	}
+	return refs
+}
+
+// fromDbThreadChirp shows chirps of accounts pending deletion as tombstones, the
+// thread keeps its shape until the deletion is cancelled.
+func fromDbThreadChirp(chirp database.Chirp, hidden bool) Chirp {
+	if hidden && !chirp.DeletedAt.Valid {
+		chirp.DeletedAt = sql.NullTime{Time: chirp.UpdatedAt, Valid: true}
+	}
+	return fromDbChirp(chirp)
+}
+
+// buildChirpTree expects replies breadth first, replies whose parent was cut by the
+// depth or size limits are dropped.
+func buildChirpTree(root Chirp, replies []Chirp) *ChirpThreadNode {
+	rootNode := &ChirpThreadNode{Chirp: root, Replies: []*ChirpThreadNode{}}
+	nodes := map[uuid.UUID]*ChirpThreadNode{root.ID: rootNode}
+	for _, reply := range replies {
+		if reply.ReplyToID == nil {
+			continue
+		}
+		parent, ok := nodes[*reply.ReplyToID]
+		if !ok {
+			continue
+		}
+		node := &ChirpThreadNode{Chirp: reply, Replies: []*ChirpThreadNode{}}
+		parent.Replies = append(parent.Replies, node)
+		nodes[reply.ID] = node
+	}
+	return rootNode
+}
+
+// deleteChirp leaves a tombstone when the chirp has replies so the threads below it
+// stay reachable, the replaced bodies go with the content. The chirp is locked first so
+// a reply committed meanwhile can't be detached by the delete.
+func deleteChirp(cfg *apiConfig, r *http.Request, chirpID uuid.UUID, userID uuid.UUID) error {
+	tx, err := cfg.conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	queries := database.New(tx)
+	if _, err := queries.LockChirp(r.Context(), database.LockChirpParams{ID: chirpID, UserID: userID}); err != nil {
+		return err
+	}
+	tombstoned, err := queries.TombstoneChirp(r.Context(), database.TombstoneChirpParams{ID: chirpID, UserID: userID})
+	if err != nil {
+		return err
+	}
+	if tombstoned > 0 {
+		err = queries.DeleteChirpRevisions(r.Context(), chirpID)
+	} else {
+		err = queries.DeleteChirp(r.Context(), database.DeleteChirpParams{ID: chirpID, UserID: userID})
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// getGetChirpThreadHandler returns the reply chain above the chirp and its replies down
+// to the depth param, reply_count tells what lies past the limits. The chirp itself may
+// be a tombstone, the replies below it are still shown.
+func getGetChirpThreadHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		depth := defaultChirpThreadDepth
+		if raw := r.URL.Query().Get("depth"); raw != "" {
+			depth, err = strconv.Atoi(raw)
+			if err != nil || depth < 0 || depth > maxChirpThreadDepth {
+				respondWithErrorJSON(w, http.StatusBadRequest, fmt.Errorf("Invalid depth %s must be between 0 and %d", raw, maxChirpThreadDepth))
+				return
+			}
+		}
+		rootRow, err := cfg.db.GetThreadChirp(r.Context(), chirpID)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		ancestorRows, err := cfg.db.GetChirpAncestors(r.Context(), database.GetChirpAncestorsParams{
+			ID:       chirpID,
+			MaxDepth: maxChirpAncestors,
+		})
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		thread := ChirpThread{Ancestors: []Chirp{}}
+		for _, row := range ancestorRows {
+			thread.Ancestors = append(thread.Ancestors, fromDbThreadChirp(database.Chirp{
+				ID:         row.ID,
+				CreatedAt:  row.CreatedAt,
+				UpdatedAt:  row.UpdatedAt,
+				Body:       row.Body,
+				UserID:     row.UserID,
+				EditedAt:   row.EditedAt,
+				ReplyToID:  row.ReplyToID,
+				ReplyCount: row.ReplyCount,
+				LikeCount:  row.LikeCount,
+				DeletedAt:  row.DeletedAt,
+			}, row.Hidden))
+		}
+		replies := []Chirp{}
+		if depth > 0 {
+			replyRows, err := cfg.db.GetChirpDescendants(r.Context(), database.GetChirpDescendantsParams{
+				ID:         chirpID,
+				MaxDepth:   int32(depth),
+				MaxResults: maxChirpThreadReplies,
+			})
+			if err != nil {
+				respondWithErrorJSON(w, http.StatusInternalServerError, err)
+				return
+			}
+			for _, row := range replyRows {
+				replies = append(replies, fromDbThreadChirp(database.Chirp{
+					ID:         row.ID,
+					CreatedAt:  row.CreatedAt,
+					UpdatedAt:  row.UpdatedAt,
+					Body:       row.Body,
+					UserID:     row.UserID,
+					EditedAt:   row.EditedAt,
+					ReplyToID:  row.ReplyToID,
+					ReplyCount: row.ReplyCount,
+					LikeCount:  row.LikeCount,
+					DeletedAt:  row.DeletedAt,
+				}, row.Hidden))
+			}
+		}
+		root := fromDbThreadChirp(database.Chirp{
+			ID:         rootRow.ID,
+			CreatedAt:  rootRow.CreatedAt,
+			UpdatedAt:  rootRow.UpdatedAt,
+			Body:       rootRow.Body,
+			UserID:     rootRow.UserID,
+			EditedAt:   rootRow.EditedAt,
+			ReplyToID:  rootRow.ReplyToID,
+			ReplyCount: rootRow.ReplyCount,
+			LikeCount:  rootRow.LikeCount,
+			DeletedAt:  rootRow.DeletedAt,
+		}, rootRow.Hidden)
+		thread.Chirp = buildChirpTree(root, replies)
+		if err := cfg.setLikedByMe(r, thread.chirpRefs()...); err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, thread)
+	})
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+func TestBuildChirpTree(t *testing.T) {
+	root := Chirp{ID: uuid.New()}
+	reply := func(parent Chirp) Chirp {
+		return Chirp{ID: uuid.New(), ReplyToID: &parent.ID}
+	}
+	first := reply(root)
+	second := reply(root)
+	nested := reply(first)
+	orphan := reply(Chirp{ID: uuid.New()})
+
+	tree := buildChirpTree(root, []Chirp{first, second, nested, orphan})
+	if len(tree.Replies) != 2 || tree.Replies[0].ID != first.ID || tree.Replies[1].ID != second.ID {
+		t.Fatalf("Invalid direct replies %+v", tree.Replies)
+	}
+	if len(tree.Replies[0].Replies) != 1 || tree.Replies[0].Replies[0].ID != nested.ID {
+		t.Fatalf("Invalid nested replies %+v", tree.Replies[0].Replies)
+	}
+	if len(tree.Replies[1].Replies) != 0 || tree.Replies[1].Replies == nil {
+		t.Fatalf("Leaves should have an empty reply list")
+	}
+}
+
+func TestFromDbThreadChirp(t *testing.T) {
+	now := time.Now()
+	author := uuid.NullUUID{UUID: uuid.New(), Valid: true}
+	testCases := map[string]struct {
+		chirp   database.Chirp
+		hidden  bool
+		deleted bool
+	}{
+		"visible":       {chirp: database.Chirp{Body: "Say my name", UserID: author}},
+		"tombstone":     {chirp: database.Chirp{UserID: author, DeletedAt: sql.NullTime{Time: now, Valid: true}}, deleted: true},
+		"purged author": {chirp: database.Chirp{DeletedAt: sql.NullTime{Time: now, Valid: true}}, deleted: true},
+		"hidden":        {chirp: database.Chirp{Body: "Say my name", UserID: author}, hidden: true, deleted: true},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			chirp := fromDbThreadChirp(test.chirp, test.hidden)
+			if chirp.Deleted != test.deleted {
+				t.Fatalf("Invalid deleted\nexpected: %v\ngot: %v", test.deleted, chirp.Deleted)
+			}
+			if test.deleted && (chirp.Body != "" || chirp.UserID != uuid.Nil) {
+				t.Fatalf("Tombstones should not leak content %+v", chirp)
+			}
+			if !test.deleted && (chirp.Body != test.chirp.Body || chirp.UserID != test.chirp.UserID.UUID) {
+				t.Fatalf("Visible chirps should be left untouched %+v", chirp)
+			}
+		})
+	}
+}
+
+func TestChirpThreadRefs(t *testing.T) {
+	root := Chirp{ID: uuid.New()}
+	first := Chirp{ID: uuid.New(), ReplyToID: &root.ID}
+	second := Chirp{ID: uuid.New(), ReplyToID: &root.ID}
+	nested := Chirp{ID: uuid.New(), ReplyToID: &first.ID}
+	ancestor := Chirp{ID: uuid.New()}
+	thread := ChirpThread{
+		Ancestors: []Chirp{ancestor},
+		Chirp:     buildChirpTree(root, []Chirp{first, second, nested}),
+	}
+
+	refs := thread.chirpRefs()
+	expected := []uuid.UUID{ancestor.ID, root.ID, first.ID, second.ID, nested.ID}
+	if len(refs) != len(expected) {
+		t.Fatalf("Invalid refs count\nexpected: %d\ngot: %d", len(expected), len(refs))
+	}
+	for i, ref := range refs {
+		if ref.ID != expected[i] {
+			t.Fatalf("Invalid ref %d\nexpected: %v\ngot: %v", i, expected[i], ref.ID)
+		}
+	}
+	likedByMe := true
+	refs[len(refs)-1].LikedByMe = &likedByMe
+	if thread.Chirp.Replies[0].Replies[0].LikedByMe == nil {
+		t.Fatalf("Refs should point into the thread")
+	}
+}
@@ -1,12 +1,13 @@
 package server
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"slices"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,59 +21,93 @@ type Chirp struct {
 	UpdatedAt time.Time `json:"updated_at"`
 	Body      string    `json:"body"`
 	UserID    uuid.UUID `json:"user_id"`
+	// EditedAt is only set once the author edited the chirp.
+	EditedAt   *time.Time `json:"edited_at,omitempty"`
+	ReplyToID  *uuid.UUID `json:"reply_to_id,omitempty"`
+	ReplyCount int32      `json:"reply_count"`
+	LikeCount  int32      `json:"like_count"`
+	// LikedByMe is only set when the caller is authenticated.
+	LikedByMe *bool `json:"liked_by_me,omitempty"`
+	// Deleted marks tombstones left in threads, they have no body nor author.
+	Deleted bool `json:"deleted,omitempty"`
 }
 
 func fromDbChirp(chirp database.Chirp) Chirp {
-	return Chirp{
-		ID:        chirp.ID,
-		UserID:    chirp.UserID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
+	c := Chirp{
+		ID:         chirp.ID,
+		UserID:     chirp.UserID.UUID,
+		CreatedAt:  chirp.CreatedAt,
+		UpdatedAt:  chirp.UpdatedAt,
+		Body:       chirp.Body,
+		ReplyCount: chirp.ReplyCount,
+		LikeCount:  chirp.LikeCount,
 	}
+	if chirp.EditedAt.Valid {
+		c.EditedAt = &chirp.EditedAt.Time
+	}
+	if chirp.ReplyToID.Valid {
+		c.ReplyToID = &chirp.ReplyToID.UUID
+	}
+	if chirp.DeletedAt.Valid {
+		c.Deleted = true
+		c.UserID = uuid.Nil
+		c.Body = ""
+		c.EditedAt = nil
+	}
+	return c
 }
 
-func getProfaneWords() [3]string { return [...]string{"kerfuffle", "sharbert", "fornax"} }
-
-func sanitizeChirpBody(body string) (string, error) {
-	if len(body) > 140 {
-		return "", fmt.Errorf("Chirp is too long")
+// sanitizeChirpBody also reports whether the chirp must be flagged for moderation.
+func sanitizeChirpBody(body string, policy chirpPolicy) (string, bool, error) {
+	body, err := validateChirpBody(body, policy.maxLength)
+	if err != nil {
+		return "", false, err
 	}
-	cleanedWords := []string{}
-	for word := range strings.SplitSeq(body, " ") {
-		isProfaneWord := false
-		for _, profaneWord := range getProfaneWords() {
-			if profaneWord == strings.ToLower(word) {
-				isProfaneWord = true
-			}
-		}
-		if isProfaneWord {
-			cleanedWords = append(cleanedWords, "****")
-		} else {
-			cleanedWords = append(cleanedWords, word)
-		}
+	masked, matches := policy.profanity.Mask(body)
+	if len(matches) == 0 {
+		return body, false, nil
+	}
+	switch policy.profanityAction {
+	case profanityReject:
+		return "", false, errChirpProfane
+	case profanityFlag:
+		return body, true, nil
+	default:
+		return masked, false, nil
+	}
+}
+
+// checkChirpAuthor explains why user may not publish chirps.
+func checkChirpAuthor(cfg *apiConfig, user database.User) error {
+	if user.DeletionRequestedAt.Valid {
+		return errAccountPendingDeletion
 	}
-	return strings.Join(cleanedWords, " "), nil
+	return requireVerifiedEmail(cfg, user)
 }
 
 func getCreateChirpHandler(cfg *apiConfig) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		type requestBody struct {
-			Body string `json:"body"`
+			Body    string     `json:"body"`
+			ReplyTo *uuid.UUID `json:"reply_to"`
 		}
 		type responseBody struct {
 			CleanedBody string `json:"cleaned_body"`
 		}
-		tokenStr, err := auth.GetBearerToken(r.Header)
+		uid, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
 		if err != nil {
-			respondWithErrorJSON(w, http.StatusUnauthorized, err)
+			respondWithAuthError(w, err)
 			return
 		}
-		uid, err := auth.ValidateJWT(tokenStr, cfg.jwtSecret)
+		user, err := cfg.db.GetUserById(r.Context(), uid)
 		if err != nil {
 			respondWithErrorJSON(w, http.StatusUnauthorized, err)
 			return
 		}
+		if err := checkChirpAuthor(cfg, user); err != nil {
+			respondWithErrorJSON(w, http.StatusForbidden, err)
+			return
+		}
 		rawBody, err := io.ReadAll(r.Body)
 		if err != nil {
 			respondWithErrorJSON(w, http.StatusBadRequest, err)
@@ -84,14 +119,24 @@ func getCreateChirpHandler(cfg *apiConfig) http.Handler {
 			respondWithErrorJSON(w, http.StatusBadRequest, err)
 			return
 		}
-		chirpBody, err := sanitizeChirpBody(body.Body)
+		chirpBody, flagged, err := sanitizeChirpBody(body.Body, cfg.chirps)
 		if err != nil {
 			respondWithErrorJSON(w, http.StatusBadRequest, err)
 			return
 		}
+		replyTo := uuid.NullUUID{}
+		if body.ReplyTo != nil {
+			if _, err := cfg.db.GetChirpById(r.Context(), *body.ReplyTo); err != nil {
+				respondWithErrorJSON(w, http.StatusBadRequest, errReplyToMissing)
+				return
+			}
+			replyTo = uuid.NullUUID{UUID: *body.ReplyTo, Valid: true}
+		}
 		chirp, err := cfg.db.CreateChirp(r.Context(), database.CreateChirpParams{
-			UserID: uid,
-			Body:   chirpBody,
+			UserID:    uid,
+			Body:      chirpBody,
+			Flagged:   flagged,
+			ReplyToID: replyTo,
 		})
 		if err != nil {
 			respondWithErrorJSON(w, http.StatusBadRequest, err)
@@ -106,29 +151,21 @@ const (
 	sortOrderDesc = "desc"
 )
 
+// getGetChirpsHandler returns one page of chirps, the next one is linked in the Link
+// header. With CHIRPS_UNPAGINATED set, requests without limit or cursor still get every chirp.
 func getGetChirpsHandler(cfg *apiConfig) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authorID := r.URL.Query().Get("author_id")
-		sort := r.URL.Query().Get("sort")
-		if sort == "" {
-			sort = sortOrderAsc
-		}
-		if sort != sortOrderAsc && sort != sortOrderDesc {
-			respondWithErrorJSON(w, http.StatusBadRequest, fmt.Errorf("Invalid sort %s must be %s or %s", sort, sortOrderAsc, sortOrderDesc))
+		page, err := parseChirpPageQuery(r.URL.Query())
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusBadRequest, err)
 			return
 		}
-		var chirpsFromDb []database.Chirp
-		var err error
-		if authorID != "" {
-			if uid, err := uuid.Parse(authorID); err != nil {
-				respondWithErrorJSON(w, http.StatusBadRequest, fmt.Errorf("Invalid author_id %s\n%#v", authorID, err))
-				return
-			} else {
-				chirpsFromDb, err = cfg.db.GetChirpsByAuthorID(r.Context(), uid)
-			}
-		} else {
-			chirpsFromDb, err = cfg.db.GetChirps(r.Context())
+		query := r.URL.Query()
+		if cfg.unpaginatedChirps && !query.Has("limit") && !query.Has("cursor") {
+			getAllChirps(cfg, w, r, page)
+			return
 		}
+		chirpsFromDb, nextCursor, err := page.fetch(cfg, r)
 		if err != nil {
 			respondWithErrorJSON(w, http.StatusInternalServerError, err)
 			return
@@ -137,17 +174,48 @@ func getGetChirpsHandler(cfg *apiConfig) http.Handler {
 		for _, c := range chirpsFromDb {
 			chirps = append(chirps, fromDbChirp(c))
 		}
-		slices.SortStableFunc(chirps, func(a Chirp, b Chirp) int {
-			if sort == sortOrderDesc {
-				return b.CreatedAt.Compare(a.CreatedAt)
-			} else {
-				return a.CreatedAt.Compare(b.CreatedAt)
-			}
-		})
+		if nextCursor != "" {
+			w.Header().Set("Link", nextChirpPageLink(cfg, r, nextCursor))
+		}
+		if err := cfg.setLikedByMe(r, chirpRefs(chirps)...); err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
 		respondWithJSON(w, http.StatusOK, chirps)
 	})
 }
 
+// getAllChirps is the unpaginated listing kept for clients that predate cursors.
+func getAllChirps(cfg *apiConfig, w http.ResponseWriter, r *http.Request, page chirpPageQuery) {
+	var chirpsFromDb []database.Chirp
+	var err error
+	if page.authorID.Valid {
+		chirpsFromDb, err = cfg.db.GetChirpsByAuthorID(r.Context(), page.authorID.UUID)
+	} else {
+		chirpsFromDb, err = cfg.db.GetChirps(r.Context())
+	}
+	if err != nil {
+		respondWithErrorJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+	chirps := []Chirp{}
+	for _, c := range chirpsFromDb {
+		chirps = append(chirps, fromDbChirp(c))
+	}
+	slices.SortStableFunc(chirps, func(a Chirp, b Chirp) int {
+		if page.sort == sortOrderDesc {
+			return b.CreatedAt.Compare(a.CreatedAt)
+		} else {
+			return a.CreatedAt.Compare(b.CreatedAt)
+		}
+	})
+	if err := cfg.setLikedByMe(r, chirpRefs(chirps)...); err != nil {
+		respondWithErrorJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, chirps)
+}
+
 func getGetChirpByIdHandler(cfg *apiConfig) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		chirpID, err := uuid.Parse(r.PathValue("chirpID"))
@@ -160,7 +228,12 @@ func getGetChirpByIdHandler(cfg *apiConfig) http.Handler {
 			respondWithErrorJSON(w, http.StatusNotFound, err)
 			return
 		}
-		respondWithJSON(w, http.StatusOK, fromDbChirp(chirpFromDb))
+		chirp := fromDbChirp(chirpFromDb)
+		if err := cfg.setLikedByMe(r, &chirp); err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, chirp)
 	})
 }
 
@@ -171,19 +244,23 @@ func getDeleteChirpByIdHandler(cfg *apiConfig) http.Handler {
 			respondWithErrorJSON(w, http.StatusBadRequest, err)
 			return
 		}
-		uid, err := auth.ValidateJWTFromHeader(r.Header, cfg.jwtSecret)
+		uid, err := cfg.authenticate(r, auth.ScopeChirpsWrite)
 		if err != nil {
-			respondWithErrorJSON(w, http.StatusUnauthorized, err)
+			respondWithAuthError(w, err)
 			return
 		}
-		if chirp, err := cfg.db.GetChirpById(r.Context(), chirpID); err != nil {
+		if chirp, err := cfg.db.GetChirpByIdIncludingFlagged(r.Context(), chirpID); err != nil {
 			respondWithErrorJSON(w, http.StatusNotFound, err)
 			return
-		} else if chirp.UserID != uid {
+		} else if chirp.UserID.UUID != uid {
 			respondWithErrorJSON(w, http.StatusForbidden, fmt.Errorf("Forbidden"))
 			return
 		}
-		err = cfg.db.DeleteChirp(r.Context(), database.DeleteChirpParams{ID: chirpID, UserID: uid})
+		err = deleteChirp(cfg, r, chirpID, uid)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
 		if err != nil {
 			respondWithErrorJSON(w, http.StatusInternalServerError, err)
 			return
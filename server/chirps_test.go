@@ -0,0 +1,38 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/the-1aw/chirpy/internal/profanity"
+)
+
+func TestSanitizeChirpBody(t *testing.T) {
+	filter := profanity.NewFilter([]string{"kerfuffle", "sharbert", "fornax"})
+	testCases := map[string]struct {
+		body     string
+		action   profanityAction
+		expected string
+		flagged  bool
+		err      error
+	}{
+		"clean":          {body: "Yeah, science!", action: profanityReject, expected: "Yeah, science!"},
+		"mask":           {body: "What a Kerfuffle!\nFornax,", action: profanityMask, expected: "What a ****!\n****,"},
+		"reject":         {body: "What a kerfuffle", action: profanityReject, err: errChirpProfane},
+		"flag":           {body: "What a sh4rbert", action: profanityFlag, expected: "What a sh4rbert", flagged: true},
+		"length checked": {body: "", action: profanityMask, err: errChirpEmpty},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			policy := chirpPolicy{maxLength: defaultChirpMaxLength, profanity: filter, profanityAction: test.action}
+			body, flagged, err := sanitizeChirpBody(test.body, policy)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Unexpected error\nexpected: %v\ngot: %v", test.err, err)
+			}
+			if body != test.expected || flagged != test.flagged {
+				t.Fatalf("Invalid sanitizing\nexpected: %q flagged %t\ngot: %q flagged %t", test.expected, test.flagged, body, flagged)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/the-1aw/chirpy/internal/auth"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+const usage = `usage: chirpy [command]
+
+Without a command the http server is started.
+
+commands:
+  promote-admin <email>  give the admin role to an existing user
+`
+
+// RunCommand handles maintenance tasks that must work before any admin exists.
+func RunCommand(args []string) error {
+	switch args[0] {
+	case "promote-admin":
+		if len(args) != 2 {
+			return fmt.Errorf("%s", usage)
+		}
+		return promoteAdmin(context.Background(), args[1])
+	default:
+		return fmt.Errorf("Unknown command %q\n%s", args[0], usage)
+	}
+}
+
+func promoteAdmin(ctx context.Context, email string) error {
+	conn, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	updated, err := database.New(conn).SetUserRoleByEmail(ctx, database.SetUserRoleByEmailParams{
+		Email: email,
+		Role:  string(auth.RoleAdmin),
+	})
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return fmt.Errorf("No user with email %s", email)
+	}
+	fmt.Printf("%s is now an admin, the role applies from their next login\n", email)
+	return nil
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/the-1aw/chirpy/internal/auth"
+)
+
+// The __Host- prefix makes browsers refuse these cookies unless they are Secure, have no
+// Domain and use Path=/, so a sibling subdomain cannot plant a csrf cookie of its own.
+const (
+	accessCookieName  = "__Host-chirpy_access"
+	refreshCookieName = "__Host-chirpy_refresh"
+	csrfCookieName    = "__Host-chirpy_csrf"
+	csrfHeaderName    = "X-CSRF-Token"
+	// csrfFormField lets server rendered forms, which cannot set headers, pass the check.
+	csrfFormField = "csrf_token"
+
+	accessTokenValidity = time.Hour
+)
+
+var errCSRFTokenInvalid = errors.New("Invalid csrf token")
+
+// setSessionCookies hands the tokens to the browser instead of the response body.
+// The csrf cookie stays readable by scripts so the client can echo it in csrfHeaderName.
+func setSessionCookies(w http.ResponseWriter, accessToken, refreshToken, csrfToken string) {
+	for _, cookie := range []*http.Cookie{
+		{Name: accessCookieName, Value: accessToken, MaxAge: int(accessTokenValidity.Seconds()), HttpOnly: true},
+		{Name: refreshCookieName, Value: refreshToken, MaxAge: int(refreshTokenValidity.Seconds()), HttpOnly: true},
+		{Name: csrfCookieName, Value: csrfToken, MaxAge: int(refreshTokenValidity.Seconds())},
+	} {
+		cookie.Path = "/"
+		cookie.Secure = true
+		cookie.SameSite = http.SameSiteLaxMode
+		http.SetCookie(w, cookie)
+	}
+}
+
+func clearSessionCookies(w http.ResponseWriter) {
+	for _, name := range []string{accessCookieName, refreshCookieName, csrfCookieName} {
+		http.SetCookie(w, &http.Cookie{Name: name, Path: "/", MaxAge: -1, Secure: true, SameSite: http.SameSiteLaxMode})
+	}
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// checkCSRF is the double-submit check, a cross-site form can send the cookies but cannot
+// read them to fill the header.
+func checkCSRF(r *http.Request) error {
+	if isSafeMethod(r.Method) {
+		return nil
+	}
+	cookie, err := r.Cookie(csrfCookieName)
+	if err != nil || cookie.Value == "" {
+		return errCSRFTokenInvalid
+	}
+	submitted := r.Header.Get(csrfHeaderName)
+	if submitted == "" {
+		submitted = r.PostFormValue(csrfFormField)
+	}
+	if subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(submitted)) != 1 {
+		return errCSRFTokenInvalid
+	}
+	return nil
+}
+
+// requestToken prefers the Authorization header and falls back to the session cookie,
+// which is only trusted on state-changing requests when the csrf check passes.
+func requestToken(r *http.Request, cookieName string) (string, bool, error) {
+	if r.Header.Get("Authorization") != "" {
+		token, err := auth.GetBearerToken(r.Header)
+		return token, false, err
+	}
+	cookie, err := r.Cookie(cookieName)
+	if err != nil || cookie.Value == "" {
+		return "", false, errors.New("Missing authorization header or session cookie")
+	}
+	if err := checkCSRF(r); err != nil {
+		return "", true, err
+	}
+	return cookie.Value, true, nil
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestToken(t *testing.T) {
+	testCases := map[string]struct {
+		method        string
+		authorization string
+		accessCookie  string
+		csrfCookie    string
+		csrfHeader    string
+		token         string
+		fromCookie    bool
+		err           error
+	}{
+		"bearer header":        {method: http.MethodPost, authorization: "Bearer header-token", token: "header-token"},
+		"header wins":          {method: http.MethodPost, authorization: "Bearer header-token", accessCookie: "cookie-token", token: "header-token"},
+		"cookie on safe route": {method: http.MethodGet, accessCookie: "cookie-token", token: "cookie-token", fromCookie: true},
+		"cookie with csrf":     {method: http.MethodPost, accessCookie: "cookie-token", csrfCookie: "csrf", csrfHeader: "csrf", token: "cookie-token", fromCookie: true},
+		"missing csrf header":  {method: http.MethodPost, accessCookie: "cookie-token", csrfCookie: "csrf", fromCookie: true, err: errCSRFTokenInvalid},
+		"mismatched csrf":      {method: http.MethodDelete, accessCookie: "cookie-token", csrfCookie: "csrf", csrfHeader: "forged", fromCookie: true, err: errCSRFTokenInvalid},
+		"missing csrf cookie":  {method: http.MethodPut, accessCookie: "cookie-token", csrfHeader: "forged", fromCookie: true, err: errCSRFTokenInvalid},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, "/api/chirps", nil)
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			if test.accessCookie != "" {
+				req.AddCookie(&http.Cookie{Name: accessCookieName, Value: test.accessCookie})
+			}
+			if test.csrfCookie != "" {
+				req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: test.csrfCookie})
+			}
+			if test.csrfHeader != "" {
+				req.Header.Set(csrfHeaderName, test.csrfHeader)
+			}
+			token, fromCookie, err := requestToken(req, accessCookieName)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Unexpected error\nexpected: %v\ngot: %v", test.err, err)
+			}
+			if err == nil && token != test.token {
+				t.Fatalf("Invalid token\nexpected: %s\ngot: %s", test.token, token)
+			}
+			if fromCookie != test.fromCookie {
+				t.Fatalf("Invalid token source\nexpected cookie: %v\ngot: %v", test.fromCookie, fromCookie)
+			}
+		})
+	}
+}
+
+func TestRequestTokenMissing(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+	if _, _, err := requestToken(req, accessCookieName); err == nil {
+		t.Fatal("Request without header or cookie should fail")
+	}
+}
@@ -0,0 +1,392 @@
+package server
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/auth"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+const (
+	dataExportCompleted = "completed"
+	dataExportPending   = "pending"
+	dataExportFailed    = "failed"
+
+	// dataExportRetention is how long an archive stays on disk, download urls are
+	// short-lived and handed out again by the status route.
+	dataExportRetention   = 7 * 24 * time.Hour
+	dataExportURLValidity = 15 * time.Minute
+	dataExportTimeout     = 10 * time.Minute
+	dataExportWorkers     = 2
+	// dataExportCooldown bounds how many archives a user can keep on disk, failed
+	// exports don't count so they can be retried right away.
+	dataExportCooldown = 24 * time.Hour
+	// A pending export whose heartbeat is older than dataExportStaleAfter is failed,
+	// whichever instance notices it first.
+	dataExportHeartbeat  = time.Minute
+	dataExportStaleAfter = 5 * dataExportHeartbeat
+)
+
+var errDataExportInProgress = errors.New("An export is already in progress")
+
+// dataExportRetryAfter is how long the user must wait before requesting a new export,
+// zero when it can be requested now.
+func dataExportRetryAfter(latest database.DataExport, now time.Time) time.Duration {
+	if latest.Status == dataExportFailed {
+		return 0
+	}
+	return max(latest.CreatedAt.Add(dataExportCooldown).Sub(now), 0)
+}
+
+// dataExporter assembles archives in the background, at most dataExportWorkers at a time
+// so a burst of requests cannot starve the database.
+type dataExporter struct {
+	dir   string
+	slots chan struct{}
+}
+
+func newDataExporter(dir string) (*dataExporter, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &dataExporter{dir: dir, slots: make(chan struct{}, dataExportWorkers)}, nil
+}
+
+// userDir groups archives by user so all of them go away with the account.
+func (e *dataExporter) userDir(userID uuid.UUID) string {
+	return filepath.Join(e.dir, userID.String())
+}
+
+func (e *dataExporter) removeUserFiles(userID uuid.UUID) error {
+	return os.RemoveAll(e.userDir(userID))
+}
+
+// ChirpyRedHistory is the current membership and the webhook events that changed it.
+type ChirpyRedHistory struct {
+	IsChirpyRed bool         `json:"is_chirpy_red"`
+	Events      []AuditEvent `json:"events"`
+}
+
+type dataExportContent struct {
+	Profile     User
+	Chirps      []Chirp
+	Sessions    []Session
+	AuditEvents []AuditEvent
+	ChirpyRed   ChirpyRedHistory
+}
+
+func loadDataExportContent(ctx context.Context, db database.Querier, userID uuid.UUID) (dataExportContent, error) {
+	content := dataExportContent{
+		Chirps:      []Chirp{},
+		Sessions:    []Session{},
+		AuditEvents: []AuditEvent{},
+		ChirpyRed:   ChirpyRedHistory{Events: []AuditEvent{}},
+	}
+	user, err := db.GetUserById(ctx, userID)
+	if err != nil {
+		return content, err
+	}
+	content.Profile = fromDbUser(user)
+	content.ChirpyRed.IsChirpyRed = user.IsChirpyRed
+	chirps, err := db.GetAllChirpsByAuthorID(ctx, userID)
+	if err != nil {
+		return content, err
+	}
+	for _, chirp := range chirps {
+		content.Chirps = append(content.Chirps, fromDbChirp(chirp))
+	}
+	sessions, err := db.GetActiveSessionsByUserID(ctx, userID)
+	if err != nil {
+		return content, err
+	}
+	for _, session := range sessions {
+		content.Sessions = append(content.Sessions, fromDbSession(session))
+	}
+	events, err := db.GetAllAuditEventsByActorID(ctx, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		return content, err
+	}
+	for _, event := range events {
+		content.AuditEvents = append(content.AuditEvents, fromDbAuditEvent(event))
+		if event.Action == string(auditChirpyRedUpgrade) {
+			content.ChirpyRed.Events = append(content.ChirpyRed.Events, fromDbAuditEvent(event))
+		}
+	}
+	return content, nil
+}
+
+func writeDataExport(w io.Writer, content dataExportContent) error {
+	archive := zip.NewWriter(w)
+	for _, file := range []struct {
+		name    string
+		payload any
+	}{
+		{"profile.json", content.Profile},
+		{"chirps.json", content.Chirps},
+		{"sessions.json", content.Sessions},
+		{"audit_events.json", content.AuditEvents},
+		{"chirpy_red.json", content.ChirpyRed},
+	} {
+		f, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.payload); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// build writes to a temporary file first so a half written archive is never served.
+func (e *dataExporter) build(ctx context.Context, db database.Querier, export database.DataExport) (string, error) {
+	content, err := loadDataExportContent(ctx, db, export.UserID)
+	if err != nil {
+		return "", err
+	}
+	dir := e.userDir(export.UserID)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(dir, "*.zip.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if err := writeDataExport(tmp, content); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, export.ID.String()+".zip")
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// heartbeat touches the export until ctx is done so other instances can tell it
+// apart from one left behind by a process that died.
+func heartbeat(ctx context.Context, db database.Querier, exportID uuid.UUID) {
+	ticker := time.NewTicker(dataExportHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := db.TouchDataExport(ctx, exportID); err != nil && ctx.Err() == nil {
+			log.Printf("Failed touching data export %s %v", exportID, err)
+		}
+	}
+}
+
+// start returns right away, the export row is updated once the archive is ready.
+func (e *dataExporter) start(db database.Querier, export database.DataExport) {
+	go func() {
+		// The export waiting for a slot is still owned by this process.
+		alive, stop := context.WithCancel(context.Background())
+		defer stop()
+		go heartbeat(alive, db, export.ID)
+		e.slots <- struct{}{}
+		defer func() { <-e.slots }()
+		ctx, cancel := context.WithTimeout(context.Background(), dataExportTimeout)
+		defer cancel()
+		path, err := e.build(ctx, db, export)
+		if err != nil {
+			log.Printf("Failed building data export %s %v", export.ID, err)
+			if err := db.FailDataExport(ctx, database.FailDataExportParams{
+				ID:    export.ID,
+				Error: "Failed assembling the export",
+			}); err != nil {
+				log.Printf("Failed recording data export failure %s %v", export.ID, err)
+			}
+			return
+		}
+		if err := db.CompleteDataExport(ctx, database.CompleteDataExportParams{
+			ID:        export.ID,
+			FilePath:  path,
+			ExpiresAt: sql.NullTime{Time: dbTime(time.Now().Add(dataExportRetention)), Valid: true},
+		}); err != nil {
+			log.Printf("Failed completing data export %s %v", export.ID, err)
+		}
+	}()
+}
+
+// runDataExportCleanup removes expired archives and fails the exports a dead process
+// left pending, it is meant to run in its own goroutine.
+func runDataExportCleanup(ctx context.Context, db database.Querier) {
+	ticker := time.NewTicker(dataExportStaleAfter)
+	defer ticker.Stop()
+	for {
+		failed, err := db.FailStaleDataExports(ctx, dbTime(time.Now().Add(-dataExportStaleAfter)))
+		if err != nil {
+			log.Printf("Failed failing stale data exports %v", err)
+		}
+		if failed > 0 {
+			log.Printf("Failed %d stale data exports", failed)
+		}
+		paths, err := db.DeleteExpiredDataExports(ctx)
+		if err != nil {
+			log.Printf("Failed deleting expired data exports %v", err)
+		}
+		for _, path := range paths {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("Failed removing data export %s %v", path, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type DataExport struct {
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Status      string     `json:"status"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
+// fromDbDataExport signs a fresh download url for completed exports that did not expire.
+func fromDbDataExport(cfg *apiConfig, e database.DataExport) (DataExport, error) {
+	export := DataExport{
+		ID:        e.ID,
+		CreatedAt: e.CreatedAt,
+		Status:    e.Status,
+	}
+	if e.Status != dataExportCompleted {
+		return export, nil
+	}
+	export.ExpiresAt = &e.ExpiresAt.Time
+	if !e.ExpiresAt.Time.After(time.Now()) {
+		return export, nil
+	}
+	token, err := cfg.keys.MakeDownloadToken(e.ID, dataExportURLValidity)
+	if err != nil {
+		return export, err
+	}
+	export.DownloadURL = fmt.Sprintf("%s/api/exports/%s/download?token=%s", cfg.publicURL, e.ID, url.QueryEscape(token))
+	return export, nil
+}
+
+func getCreateDataExportHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, err := cfg.authenticate(r, auth.ScopeSession)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		latest, err := cfg.db.GetLatestDataExport(r.Context(), uid)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if err == nil && latest.Status == dataExportPending {
+			respondWithErrorJSON(w, http.StatusConflict, errDataExportInProgress)
+			return
+		}
+		if err == nil {
+			if wait := dataExportRetryAfter(latest, time.Now()); wait > 0 {
+				respondWithRetryAfter(w, wait, fmt.Errorf("Only one export can be requested every %v", dataExportCooldown))
+				return
+			}
+		}
+		export, err := cfg.db.CreateDataExport(r.Context(), uid)
+		if errors.Is(err, sql.ErrNoRows) || isUniqueViolation(err) {
+			respondWithErrorJSON(w, http.StatusConflict, errDataExportInProgress)
+			return
+		}
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		cfg.exports.start(cfg.db, export)
+		cfg.audit.record(r, uid, auditDataExport, export.ID.String(), auditSuccess)
+		res, err := fromDbDataExport(cfg, export)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Location", "/api/users/me/export/"+export.ID.String())
+		respondWithJSON(w, http.StatusAccepted, res)
+	})
+}
+
+func getGetDataExportHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, err := cfg.authenticate(r, auth.ScopeSession)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		exportID, err := uuid.Parse(r.PathValue("exportID"))
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		export, err := cfg.db.GetDataExport(r.Context(), database.GetDataExportParams{ID: exportID, UserID: uid})
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		res, err := fromDbDataExport(cfg, export)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, res)
+	})
+}
+
+// getDownloadDataExportHandler is authenticated by the signed token in the url alone so
+// the link works from a plain browser download.
+func getDownloadDataExportHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exportID, err := uuid.Parse(r.PathValue("exportID"))
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		signedID, err := cfg.keys.ValidateDownloadToken(r.URL.Query().Get("token"))
+		if err != nil || signedID != exportID {
+			respondWithErrorJSON(w, http.StatusForbidden, errors.New("Invalid or expired download url"))
+			return
+		}
+		export, err := cfg.db.GetDataExportById(r.Context(), exportID)
+		if err != nil || export.Status != dataExportCompleted || !export.ExpiresAt.Time.After(time.Now()) {
+			respondWithErrorJSON(w, http.StatusNotFound, errors.New("Export not found"))
+			return
+		}
+		f, err := os.Open(export.FilePath)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, errors.New("Export not found"))
+			return
+		}
+		defer f.Close()
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%s.zip"`, export.ID))
+		http.ServeContent(w, r, "", export.UpdatedAt, f)
+	})
+}
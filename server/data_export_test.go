@@ -0,0 +1,100 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+func TestWriteDataExport(t *testing.T) {
+	uid := uuid.New()
+	content := dataExportContent{
+		Profile:     User{ID: uid, Email: "saul@bettercall.com", IsChirpyRed: true},
+		Chirps:      []Chirp{{ID: uuid.New(), UserID: uid, Body: "Better call Saul!"}},
+		Sessions:    []Session{},
+		AuditEvents: []AuditEvent{{ID: uuid.New(), Action: string(auditChirpyRedUpgrade), CreatedAt: time.Now()}},
+		ChirpyRed:   ChirpyRedHistory{IsChirpyRed: true, Events: []AuditEvent{}},
+	}
+	buf := &bytes.Buffer{}
+	if err := writeDataExport(buf, content); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Invalid zip archive %v", err)
+	}
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed opening %s %v", f.Name, err)
+		}
+		files[f.Name], _ = io.ReadAll(r)
+		r.Close()
+	}
+
+	testCases := map[string]struct {
+		file  string
+		check func(data []byte) bool
+	}{
+		"profile": {file: "profile.json", check: func(data []byte) bool {
+			user := User{}
+			return json.Unmarshal(data, &user) == nil && user.ID == uid && user.Email == content.Profile.Email
+		}},
+		"chirps": {file: "chirps.json", check: func(data []byte) bool {
+			chirps := []Chirp{}
+			return json.Unmarshal(data, &chirps) == nil && len(chirps) == 1 && chirps[0].Body == "Better call Saul!"
+		}},
+		"empty sessions": {file: "sessions.json", check: func(data []byte) bool {
+			return string(bytes.TrimSpace(data)) == "[]"
+		}},
+		"audit events": {file: "audit_events.json", check: func(data []byte) bool {
+			events := []AuditEvent{}
+			return json.Unmarshal(data, &events) == nil && len(events) == 1
+		}},
+		"chirpy red": {file: "chirpy_red.json", check: func(data []byte) bool {
+			history := ChirpyRedHistory{}
+			return json.Unmarshal(data, &history) == nil && history.IsChirpyRed
+		}},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			data, ok := files[test.file]
+			if !ok {
+				t.Fatalf("Missing %s in the archive", test.file)
+			}
+			if !test.check(data) {
+				t.Fatalf("Invalid %s\n%s", test.file, data)
+			}
+		})
+	}
+}
+
+func TestDataExportRetryAfter(t *testing.T) {
+	now := time.Now()
+	testCases := map[string]struct {
+		export   database.DataExport
+		expected time.Duration
+	}{
+		"recent export":  {export: database.DataExport{Status: dataExportCompleted, CreatedAt: now.Add(-time.Hour)}, expected: dataExportCooldown - time.Hour},
+		"cooldown over":  {export: database.DataExport{Status: dataExportCompleted, CreatedAt: now.Add(-dataExportCooldown)}},
+		"old export":     {export: database.DataExport{Status: dataExportCompleted, CreatedAt: now.Add(-3 * dataExportCooldown)}},
+		"failed export":  {export: database.DataExport{Status: dataExportFailed, CreatedAt: now.Add(-time.Minute)}},
+		"pending export": {export: database.DataExport{Status: dataExportPending, CreatedAt: now}, expected: dataExportCooldown},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if wait := dataExportRetryAfter(test.export, now); wait != test.expected {
+				t.Fatalf("Invalid wait\nexpected: %v\ngot: %v", test.expected, wait)
+			}
+		})
+	}
+}
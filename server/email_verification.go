@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"time"
+
+	"github.com/the-1aw/chirpy/internal/auth"
+	"github.com/the-1aw/chirpy/internal/database"
+	"github.com/the-1aw/chirpy/internal/mailer"
+)
+
+const (
+	emailVerificationTokenValidity  = time.Hour * 24
+	emailVerificationResendInterval = time.Minute
+)
+
+var errEmailNotVerified = errors.New("Email must be verified first")
+
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return fmt.Errorf("Invalid email %q", email)
+	}
+	return nil
+}
+
+func sendEmailVerification(ctx context.Context, cfg *apiConfig, user database.User) error {
+	token := auth.MakeRefreshToken()
+	if err := cfg.db.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(emailVerificationTokenValidity),
+	}); err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/api/users/verify?token=%s", cfg.publicURL, url.QueryEscape(token))
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy email",
+		Body:    fmt.Sprintf("Welcome to Chirpy!\n\nConfirm your email address by opening this link within %v:\n\n%s\n", emailVerificationTokenValidity, link),
+	})
+}
+
+// requireVerifiedEmail is a no-op unless REQUIRE_VERIFIED_EMAIL is enabled.
+func requireVerifiedEmail(cfg *apiConfig, user database.User) error {
+	if !cfg.requireVerifiedEmail || user.EmailVerifiedAt.Valid {
+		return nil
+	}
+	return errEmailNotVerified
+}
+
+func getVerifyEmailHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type requestBody struct {
+			Token string `json:"token"`
+		}
+		req := requestBody{Token: r.URL.Query().Get("token")}
+		if r.Method == http.MethodPost {
+			decoder := json.NewDecoder(r.Body)
+			if err := decoder.Decode(&req); err != nil {
+				respondWithErrorJSON(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if req.Token == "" {
+			respondWithErrorJSON(w, http.StatusBadRequest, errors.New("Token is required"))
+			return
+		}
+		verificationToken, err := cfg.db.ConsumeEmailVerificationToken(r.Context(), auth.HashToken(req.Token))
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErrorJSON(w, http.StatusUnauthorized, errors.New("Invalid or expired verification token"))
+			return
+		}
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		// The token is bound to the address it was sent to, changing email in between voids it.
+		verified, err := cfg.db.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+			ID:    verificationToken.UserID,
+			Email: verificationToken.Email,
+		})
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if verified == 0 {
+			respondWithErrorJSON(w, http.StatusUnauthorized, errors.New("Invalid or expired verification token"))
+			return
+		}
+		cfg.audit.record(r, verificationToken.UserID, auditEmailVerify, auditEmail(verificationToken.Email), auditSuccess)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func getResendEmailVerificationHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, err := cfg.authenticate(r, auth.ScopeSession)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		user, err := cfg.db.GetUserById(r.Context(), uid)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		if user.EmailVerifiedAt.Valid {
+			respondWithErrorJSON(w, http.StatusConflict, errors.New("Email already verified"))
+			return
+		}
+		latest, err := cfg.db.GetLatestEmailVerificationTokenByUserID(r.Context(), uid)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if err == nil {
+			if wait := time.Until(latest.CreatedAt.Add(emailVerificationResendInterval)); wait > 0 {
+				respondWithRetryAfter(w, wait, errors.New("Verification email sent too recently"))
+				return
+			}
+		}
+		if err := sendEmailVerification(r.Context(), cfg, user); err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
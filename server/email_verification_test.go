@@ -0,0 +1,29 @@
+package server
+
+import "testing"
+
+func TestValidateEmail(t *testing.T) {
+	testCases := map[string]struct {
+		email string
+		valid bool
+	}{
+		"base case":       {email: "saul@bettercall.com", valid: true},
+		"missing domain":  {email: "saul@", valid: false},
+		"missing at":      {email: "saul.bettercall.com", valid: false},
+		"display name":    {email: "Saul Goodman <saul@bettercall.com>", valid: false},
+		"empty":           {email: "", valid: false},
+		"trailing spaces": {email: "saul@bettercall.com ", valid: false},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := validateEmail(test.email)
+			if err != nil && test.valid {
+				t.Fatalf("Validation failed for %q %v", test.email, err)
+			}
+			if err == nil && !test.valid {
+				t.Fatalf("Expected failure for %q", test.email)
+			}
+		})
+	}
+}
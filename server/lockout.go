@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/the-1aw/chirpy/internal/lockout"
+)
+
+var (
+	loginAccountPolicy = lockout.Policy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		MaxFailures:     10,
+		LockoutDuration: time.Minute * 15,
+		Window:          time.Hour,
+	}
+	// Many users can share an address behind a NAT, so addresses get more leeway than accounts.
+	loginIPPolicy = lockout.Policy{
+		FreeAttempts:    20,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		MaxFailures:     100,
+		LockoutDuration: time.Minute * 15,
+		Window:          time.Hour,
+	}
+)
+
+var errTooManyLoginAttempts = fmt.Errorf("Too many failed login attempts")
+
+// loginGuard tracks failed logins per account and per client address. It is checked
+// before any password hash is verified so it also protects against cpu exhaustion.
+type loginGuard struct {
+	accounts *lockout.Tracker
+	ips      *lockout.Tracker
+}
+
+func newLoginGuard(store lockout.Store) *loginGuard {
+	return &loginGuard{
+		accounts: lockout.NewTracker(store, loginAccountPolicy),
+		ips:      lockout.NewTracker(store, loginIPPolicy),
+	}
+}
+
+func accountLockoutKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func ipLockoutKey(ip string) string {
+	return "ip:" + ip
+}
+
+func (g *loginGuard) retryAfter(ctx context.Context, email string, client clientInfo) (time.Duration, error) {
+	accountWait, err := g.accounts.RetryAfter(ctx, accountLockoutKey(email))
+	if err != nil {
+		return 0, err
+	}
+	ipWait, err := g.ips.RetryAfter(ctx, ipLockoutKey(client.IPAddress))
+	if err != nil {
+		return 0, err
+	}
+	return max(accountWait, ipWait), nil
+}
+
+func (g *loginGuard) fail(ctx context.Context, email string, client clientInfo) error {
+	if err := g.accounts.Fail(ctx, accountLockoutKey(email)); err != nil {
+		return err
+	}
+	return g.ips.Fail(ctx, ipLockoutKey(client.IPAddress))
+}
+
+// succeed only clears the account, one valid account must not unlock a whole address.
+func (g *loginGuard) succeed(ctx context.Context, email string) error {
+	return g.accounts.Reset(ctx, accountLockoutKey(email))
+}
+
+func (cfg *apiConfig) clearLockout(w http.ResponseWriter, r *http.Request) {
+	if err := cfg.loginGuard.succeed(r.Context(), r.PathValue("email")); err != nil {
+		respondWithErrorJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+	cfg.audit.record(r, cfg.requestActor(r), auditLockoutClear, auditEmail(r.PathValue("email")), auditSuccess)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/auth"
+	"github.com/the-1aw/chirpy/internal/database"
+	"github.com/the-1aw/chirpy/internal/mailer"
+)
+
+const magicLinkTokenValidity = time.Minute * 15
+
+// noPassword is stored for accounts created without a password, it never matches a hash.
+const noPassword = ""
+
+func sendMagicLink(ctx context.Context, cfg *apiConfig, email string, useCookies bool) error {
+	user, err := cfg.db.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	token := auth.MakeRefreshToken()
+	if err := cfg.db.CreateMagicLinkToken(ctx, database.CreateMagicLinkTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(magicLinkTokenValidity),
+	}); err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/api/login/magic/%s", cfg.publicURL, url.PathEscape(token))
+	if useCookies {
+		link += "?use_cookies=true"
+	}
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy login link",
+		Body: fmt.Sprintf(
+			"Open this link within %v to log in to Chirpy, it only works once:\n\n%s\n\nIf it wasn't you, you can ignore this email.\n",
+			magicLinkTokenValidity,
+			link,
+		),
+	})
+}
+
+func getRequestMagicLinkHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type requestBody struct {
+			Email      string `json:"email"`
+			UseCookies bool   `json:"use_cookies"`
+		}
+		decoder := json.NewDecoder(r.Body)
+		req := requestBody{}
+		if err := decoder.Decode(&req); err != nil || req.Email == "" {
+			respondWithErrorJSON(w, http.StatusBadRequest, fmt.Errorf("Bad request %v", err))
+			return
+		}
+		// Same as password resets, the response never tells whether the account exists.
+		if err := sendMagicLink(r.Context(), cfg, req.Email, req.UseCookies); err != nil {
+			log.Printf("Failed sending magic link %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+func getMagicLinkLoginHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errInvalidLink := errors.New("Invalid or expired login link")
+		magicToken, err := cfg.db.ConsumeMagicLinkToken(r.Context(), auth.HashToken(r.PathValue("token")))
+		if errors.Is(err, sql.ErrNoRows) {
+			cfg.audit.record(r, uuid.Nil, auditMagicLinkLogin, "", auditFailure)
+			respondWithErrorJSON(w, http.StatusUnauthorized, errInvalidLink)
+			return
+		}
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		user, err := cfg.db.GetUserById(r.Context(), magicToken.UserID)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusUnauthorized, err)
+			return
+		}
+		// The link was mailed to a previous address, whoever reads that inbox is not the owner anymore.
+		if user.Email != magicToken.Email {
+			cfg.audit.record(r, user.ID, auditMagicLinkLogin, auditEmail(magicToken.Email), auditFailure)
+			respondWithErrorJSON(w, http.StatusUnauthorized, errInvalidLink)
+			return
+		}
+		// Opening the link proves the address as well as a verification link would.
+		if !user.EmailVerifiedAt.Valid {
+			verified, err := cfg.db.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+				ID:    user.ID,
+				Email: user.Email,
+			})
+			if err != nil {
+				log.Printf("Failed verifying email from magic link %v", err)
+			}
+			if verified > 0 {
+				user.EmailVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			}
+		}
+		cfg.audit.record(r, user.ID, auditMagicLinkLogin, auditEmail(user.Email), auditSuccess)
+		if user.TotpEnabledAt.Valid {
+			respondWithMFAChallenge(w, cfg, user)
+			return
+		}
+		respondWithLoginTokens(w, r, cfg, user, r.URL.Query().Get("use_cookies") == "true")
+	})
+}
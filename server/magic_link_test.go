@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/auth"
+	"github.com/the-1aw/chirpy/internal/database"
+	"github.com/the-1aw/chirpy/internal/mailer"
+)
+
+func (db *memoryQueries) CreateMagicLinkToken(_ context.Context, arg database.CreateMagicLinkTokenParams) error {
+	db.magicLinks[arg.TokenHash] = database.MagicLinkToken{
+		TokenHash: arg.TokenHash,
+		CreatedAt: time.Now(),
+		UserID:    arg.UserID,
+		Email:     arg.Email,
+		ExpiresAt: arg.ExpiresAt,
+	}
+	return nil
+}
+
+func (db *memoryQueries) ConsumeMagicLinkToken(_ context.Context, tokenHash string) (database.MagicLinkToken, error) {
+	token, ok := db.magicLinks[tokenHash]
+	if !ok || token.UsedAt.Valid || !token.ExpiresAt.After(time.Now()) {
+		return database.MagicLinkToken{}, sql.ErrNoRows
+	}
+	token.UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	db.magicLinks[tokenHash] = token
+	return token, nil
+}
+
+func (db *memoryQueries) VerifyUserEmail(_ context.Context, arg database.VerifyUserEmailParams) (int64, error) {
+	user, ok := db.users[arg.ID]
+	if !ok || user.Email != arg.Email {
+		return 0, nil
+	}
+	user.EmailVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	db.users[arg.ID] = user
+	return 1, nil
+}
+
+var magicLinkPattern = regexp.MustCompile(`/api/login/magic/([^?\s]+)`)
+
+// mailedMagicLinks returns the token of every link mailed so far, oldest first.
+func mailedMagicLinks(t *testing.T, m *mailer.FileMailer) []string {
+	paths, err := m.Messages()
+	if err != nil {
+		t.Fatalf("Failed listing mails %v", err)
+	}
+	tokens := []string{}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed reading mail %v", err)
+		}
+		if match := magicLinkPattern.FindSubmatch(content); match != nil {
+			tokens = append(tokens, string(match[1]))
+		}
+	}
+	return tokens
+}
+
+func TestMagicLink(t *testing.T) {
+	testCases := map[string]struct {
+		email          string
+		hashedPassword string
+		// before runs between the mail and the first login attempt.
+		before func(db *memoryQueries)
+		opens  int
+		mailed bool
+		status int
+	}{
+		"login":         {email: "saul@bettercall.com", hashedPassword: "hash", opens: 1, mailed: true, status: http.StatusOK},
+		"single use":    {email: "saul@bettercall.com", hashedPassword: "hash", opens: 2, mailed: true, status: http.StatusUnauthorized},
+		"no password":   {email: "saul@bettercall.com", hashedPassword: noPassword, opens: 1, mailed: true, status: http.StatusOK},
+		"unknown email": {email: "kim@bettercall.com", hashedPassword: "hash", mailed: false},
+		"expired": {
+			email:          "saul@bettercall.com",
+			hashedPassword: "hash",
+			before: func(db *memoryQueries) {
+				for hash, token := range db.magicLinks {
+					token.ExpiresAt = time.Now().Add(-time.Second)
+					db.magicLinks[hash] = token
+				}
+			},
+			opens:  1,
+			mailed: true,
+			status: http.StatusUnauthorized,
+		},
+		"email changed": {
+			email:          "saul@bettercall.com",
+			hashedPassword: "hash",
+			before: func(db *memoryQueries) {
+				for id, user := range db.users {
+					user.Email = "jimmy@bettercall.com"
+					db.users[id] = user
+				}
+			},
+			opens:  1,
+			mailed: true,
+			status: http.StatusUnauthorized,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			user := database.User{
+				ID:             uuid.New(),
+				Email:          "saul@bettercall.com",
+				HashedPassword: test.hashedPassword,
+				Role:           string(auth.RoleUser),
+			}
+			db := newMemoryQueries(user)
+			m, err := mailer.NewFileMailer(t.TempDir(), "chirpy@localhost")
+			if err != nil {
+				t.Fatalf("Failed creating mailer %v", err)
+			}
+			cfg := &apiConfig{
+				db:        db,
+				keys:      auth.NewHMACKeySet("validSecret"),
+				mailer:    m,
+				audit:     newAuditLog(db),
+				publicURL: "http://localhost:8080",
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/login/magic", strings.NewReader(`{"email": "`+test.email+`"}`))
+			rec := httptest.NewRecorder()
+			getRequestMagicLinkHandler(cfg).ServeHTTP(rec, req)
+			// Unknown addresses get the same answer so the endpoint can't list accounts.
+			if rec.Code != http.StatusAccepted || rec.Body.Len() != 0 {
+				t.Fatalf("Unexpected response %d %q", rec.Code, rec.Body.String())
+			}
+			links := mailedMagicLinks(t, m)
+			if (len(links) == 1) != test.mailed || len(db.magicLinks) != len(links) {
+				t.Fatalf("Unexpected mails %v and tokens %d", links, len(db.magicLinks))
+			}
+			if !test.mailed {
+				return
+			}
+			if test.before != nil {
+				test.before(db)
+			}
+
+			for i := range test.opens {
+				req = httptest.NewRequest(http.MethodGet, "/api/login/magic/"+links[0], nil)
+				req.SetPathValue("token", links[0])
+				rec = httptest.NewRecorder()
+				getMagicLinkLoginHandler(cfg).ServeHTTP(rec, req)
+				if i < test.opens-1 && rec.Code != http.StatusOK {
+					t.Fatalf("Open %d should log in, got %d %s", i+1, rec.Code, rec.Body.String())
+				}
+			}
+			if rec.Code != test.status {
+				t.Fatalf("Unexpected status\nexpected: %d\ngot: %d %s", test.status, rec.Code, rec.Body.String())
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+			if !db.users[user.ID].EmailVerifiedAt.Valid {
+				t.Fatalf("Opening the link should verify the email")
+			}
+			if active := db.activeRefreshTokens(); active != 1 {
+				t.Fatalf("Expected a single session, got %d", active)
+			}
+		})
+	}
+}
@@ -0,0 +1,464 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/auth"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+const oauthCodeValidity = time.Minute * 5
+
+// oauthError follows the error response of RFC 6749 section 5.2.
+type oauthError struct {
+	status      int
+	code        string
+	description string
+}
+
+func (e *oauthError) Error() string {
+	return fmt.Sprintf("%s: %s", e.code, e.description)
+}
+
+func newOAuthError(status int, code, description string) *oauthError {
+	return &oauthError{status: status, code: code, description: description}
+}
+
+func respondWithOAuthError(w http.ResponseWriter, err error) {
+	oerr := &oauthError{}
+	if !errors.As(err, &oerr) {
+		oerr = newOAuthError(http.StatusInternalServerError, "server_error", err.Error())
+	}
+	if oerr.code == "invalid_client" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	respondWithJSON(w, oerr.status, map[string]string{
+		"error":             oerr.code,
+		"error_description": oerr.description,
+	})
+}
+
+func redirectWithParams(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		respondWithErrorJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+	query := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+type authorizationRequest struct {
+	client        database.OauthClient
+	redirectURI   string
+	scopes        []auth.Scope
+	state         string
+	codeChallenge string
+	nonce         string
+}
+
+// params are the hidden fields the consent form posts back.
+func (req authorizationRequest) params() url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {req.client.ID.String()},
+		"redirect_uri":          {req.redirectURI},
+		"scope":                 {auth.FormatScopes(req.scopes)},
+		"state":                 {req.state},
+		"code_challenge":        {req.codeChallenge},
+		"code_challenge_method": {auth.PKCEMethodS256},
+		"nonce":                 {req.nonce},
+	}
+}
+
+// parseAuthorizationRequest leaves redirectURI empty as long as the client and its
+// redirect uri are not trusted, errors must then be shown instead of redirected.
+func parseAuthorizationRequest(r *http.Request, cfg *apiConfig, values url.Values) (authorizationRequest, error) {
+	req := authorizationRequest{}
+	clientID, err := uuid.Parse(values.Get("client_id"))
+	if err != nil {
+		return req, errors.New("Invalid client_id")
+	}
+	req.client, err = cfg.db.GetOAuthClient(r.Context(), clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return req, errors.New("Unknown client")
+	}
+	if err != nil {
+		return req, err
+	}
+	// Exact matching only, prefix or pattern matching is how open redirects happen.
+	if !slices.Contains(req.client.RedirectUris, values.Get("redirect_uri")) {
+		return req, errors.New("Redirect uri is not registered for this client")
+	}
+	req.redirectURI = values.Get("redirect_uri")
+	req.state = values.Get("state")
+	req.nonce = values.Get("nonce")
+	if values.Get("response_type") != "code" {
+		return req, newOAuthError(http.StatusBadRequest, "unsupported_response_type", "Only the code response type is supported")
+	}
+	req.codeChallenge = values.Get("code_challenge")
+	if values.Get("code_challenge_method") != auth.PKCEMethodS256 || !auth.IsValidPKCEChallenge(req.codeChallenge) {
+		return req, newOAuthError(http.StatusBadRequest, "invalid_request", "A S256 code_challenge is required")
+	}
+	req.scopes, err = auth.ParseOAuthScopes(values.Get("scope"))
+	if err != nil {
+		return req, newOAuthError(http.StatusBadRequest, "invalid_scope", err.Error())
+	}
+	for _, scope := range req.scopes {
+		if !slices.Contains(req.client.Scopes, string(scope)) {
+			return req, newOAuthError(http.StatusBadRequest, "invalid_scope", fmt.Sprintf("Scope %q is not allowed for this client", scope))
+		}
+	}
+	return req, nil
+}
+
+func respondWithAuthorizationError(w http.ResponseWriter, r *http.Request, cfg *apiConfig, req authorizationRequest, err error) {
+	if req.redirectURI == "" {
+		respondWithErrorJSON(w, http.StatusBadRequest, err)
+		return
+	}
+	oerr := &oauthError{}
+	if !errors.As(err, &oerr) {
+		oerr = newOAuthError(http.StatusInternalServerError, "server_error", err.Error())
+	}
+	params := url.Values{"error": {oerr.code}, "error_description": {oerr.description}, "iss": {cfg.publicURL}}
+	if req.state != "" {
+		params.Set("state", req.state)
+	}
+	redirectWithParams(w, r, req.redirectURI, params)
+}
+
+// getAuthorizeHandler shows the consent page, only browser sessions can consent since the
+// form relies on the session cookies.
+func getAuthorizeHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := parseAuthorizationRequest(r, cfg, r.URL.Query())
+		if err != nil {
+			respondWithAuthorizationError(w, r, cfg, req, err)
+			return
+		}
+		csrfCookie, err := r.Cookie(csrfCookieName)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusUnauthorized, errors.New("Log in with use_cookies to authorize applications"))
+			return
+		}
+		uid, err := cfg.authenticate(r, auth.ScopeSession)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		user, err := cfg.db.GetUserById(r.Context(), uid)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusUnauthorized, err)
+			return
+		}
+		fields := req.params()
+		fields.Set(csrfFormField, csrfCookie.Value)
+		renderConsentPage(w, consentPage{
+			ClientName: req.client.Name,
+			Email:      user.Email,
+			Scopes:     req.scopes,
+			Fields:     fields,
+		})
+	})
+}
+
+func getAuthorizeDecisionHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			respondWithErrorJSON(w, http.StatusBadRequest, err)
+			return
+		}
+		req, err := parseAuthorizationRequest(r, cfg, r.PostForm)
+		if err != nil {
+			respondWithAuthorizationError(w, r, cfg, req, err)
+			return
+		}
+		uid, err := cfg.authenticate(r, auth.ScopeSession)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		if r.PostForm.Get("decision") != "allow" {
+			cfg.audit.record(r, uid, auditOAuthAuthorize, req.client.ID.String(), auditFailure)
+			respondWithAuthorizationError(w, r, cfg, req, newOAuthError(http.StatusForbidden, "access_denied", "The user denied the request"))
+			return
+		}
+		scopeNames := []string{}
+		for _, scope := range req.scopes {
+			scopeNames = append(scopeNames, string(scope))
+		}
+		code := auth.MakeRefreshToken()
+		if err := cfg.db.CreateOAuthAuthorizationCode(r.Context(), database.CreateOAuthAuthorizationCodeParams{
+			CodeHash:      auth.HashToken(code),
+			ClientID:      req.client.ID,
+			UserID:        uid,
+			RedirectUri:   req.redirectURI,
+			Scopes:        scopeNames,
+			CodeChallenge: req.codeChallenge,
+			Nonce:         req.nonce,
+			ExpiresAt:     time.Now().Add(oauthCodeValidity),
+		}); err != nil {
+			respondWithAuthorizationError(w, r, cfg, req, err)
+			return
+		}
+		cfg.audit.record(r, uid, auditOAuthAuthorize, req.client.ID.String(), auditSuccess)
+		params := url.Values{"code": {code}, "iss": {cfg.publicURL}}
+		if req.state != "" {
+			params.Set("state", req.state)
+		}
+		redirectWithParams(w, r, req.redirectURI, params)
+	})
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+func toScopes(scopeNames []string) []auth.Scope {
+	scopes := []auth.Scope{}
+	for _, scope := range scopeNames {
+		scopes = append(scopes, auth.Scope(scope))
+	}
+	return scopes
+}
+
+func exchangeAuthorizationCode(r *http.Request, cfg *apiConfig, client database.OauthClient) (oauthTokenResponse, error) {
+	code, redirectURI, verifier := r.PostFormValue("code"), r.PostFormValue("redirect_uri"), r.PostFormValue("code_verifier")
+	if code == "" || redirectURI == "" || verifier == "" {
+		return oauthTokenResponse{}, newOAuthError(http.StatusBadRequest, "invalid_request", "code, redirect_uri and code_verifier are required")
+	}
+	errInvalidGrant := newOAuthError(http.StatusBadRequest, "invalid_grant", "Invalid or expired authorization code")
+	authCode, err := cfg.db.ConsumeOAuthAuthorizationCode(r.Context(), database.ConsumeOAuthAuthorizationCodeParams{
+		CodeHash: auth.HashToken(code),
+		ClientID: client.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return oauthTokenResponse{}, errInvalidGrant
+	}
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+	if authCode.RedirectUri != redirectURI || !auth.VerifyPKCE(verifier, authCode.CodeChallenge) {
+		return oauthTokenResponse{}, errInvalidGrant
+	}
+	user, err := cfg.db.GetUserById(r.Context(), authCode.UserID)
+	if err != nil {
+		return oauthTokenResponse{}, errInvalidGrant
+	}
+	session := clientInfoFromRequest(r)
+	rt, err := cfg.db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:     auth.MakeRefreshToken(),
+		ExpiresAt: time.Now().Add(refreshTokenValidity),
+		UserID:    user.ID,
+		FamilyID:  uuid.New(),
+		UserAgent: session.UserAgent,
+		IpAddress: session.IPAddress,
+		ClientID:  uuid.NullUUID{UUID: client.ID, Valid: true},
+		Scopes:    authCode.Scopes,
+	})
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+	res, err := makeOAuthTokenResponse(cfg, client, rt)
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+	scopes := toScopes(authCode.Scopes)
+	if slices.Contains(scopes, auth.ScopeOpenID) {
+		idToken := auth.IDToken{
+			Issuer:   cfg.publicURL,
+			ClientID: client.ID.String(),
+			UserID:   user.ID,
+			Nonce:    authCode.Nonce,
+		}
+		if slices.Contains(scopes, auth.ScopeEmail) {
+			idToken.Email = user.Email
+			idToken.EmailVerified = user.EmailVerifiedAt.Valid
+		}
+		res.IDToken, err = cfg.keys.MakeIDToken(idToken, accessTokenValidity)
+		if err != nil {
+			return oauthTokenResponse{}, err
+		}
+	}
+	return res, nil
+}
+
+func refreshOAuthToken(r *http.Request, cfg *apiConfig, client database.OauthClient) (oauthTokenResponse, error) {
+	refreshToken := r.PostFormValue("refresh_token")
+	if refreshToken == "" {
+		return oauthTokenResponse{}, newOAuthError(http.StatusBadRequest, "invalid_request", "refresh_token is required")
+	}
+	rt, err := cfg.rotateRefreshToken(r.Context(), refreshToken, uuid.NullUUID{UUID: client.ID, Valid: true}, clientInfoFromRequest(r))
+	if errors.Is(err, errRefreshTokenReused) {
+		cfg.audit.record(r, rt.UserID, auditRefreshTokenReuse, client.ID.String(), auditFailure)
+	}
+	if errors.Is(err, errRefreshTokenInvalid) || errors.Is(err, errRefreshTokenReused) {
+		return oauthTokenResponse{}, newOAuthError(http.StatusBadRequest, "invalid_grant", err.Error())
+	}
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+	return makeOAuthTokenResponse(cfg, client, rt)
+}
+
+func makeOAuthTokenResponse(cfg *apiConfig, client database.OauthClient, rt database.RefreshToken) (oauthTokenResponse, error) {
+	scopes := toScopes(rt.Scopes)
+	accessToken, err := cfg.keys.MakeOAuthAccessToken(rt.UserID, client.ID.String(), scopes, accessTokenValidity)
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+	return oauthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(accessTokenValidity.Seconds()),
+		RefreshToken: rt.Token,
+		Scope:        auth.FormatScopes(scopes),
+	}, nil
+}
+
+func getOAuthTokenHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		if err := r.ParseForm(); err != nil {
+			respondWithOAuthError(w, newOAuthError(http.StatusBadRequest, "invalid_request", err.Error()))
+			return
+		}
+		client, err := authenticateOAuthClient(r, cfg)
+		if errors.Is(err, errInvalidOAuthClient) {
+			respondWithOAuthError(w, newOAuthError(http.StatusUnauthorized, "invalid_client", err.Error()))
+			return
+		}
+		if err != nil {
+			respondWithOAuthError(w, err)
+			return
+		}
+		var res oauthTokenResponse
+		switch r.PostFormValue("grant_type") {
+		case "authorization_code":
+			res, err = exchangeAuthorizationCode(r, cfg, client)
+		case "refresh_token":
+			res, err = refreshOAuthToken(r, cfg, client)
+		default:
+			err = newOAuthError(http.StatusBadRequest, "unsupported_grant_type", "Only authorization_code and refresh_token are supported")
+		}
+		if err != nil {
+			respondWithOAuthError(w, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, res)
+	})
+}
+
+// getOAuthRevokeHandler implements RFC 7009, access tokens are short lived JWTs and cannot
+// be revoked so only refresh tokens are looked up. Unknown tokens are not an error.
+func getOAuthRevokeHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			respondWithOAuthError(w, newOAuthError(http.StatusBadRequest, "invalid_request", err.Error()))
+			return
+		}
+		client, err := authenticateOAuthClient(r, cfg)
+		if errors.Is(err, errInvalidOAuthClient) {
+			respondWithOAuthError(w, newOAuthError(http.StatusUnauthorized, "invalid_client", err.Error()))
+			return
+		}
+		if err != nil {
+			respondWithOAuthError(w, err)
+			return
+		}
+		rt, err := cfg.db.GetRefreshToken(r.Context(), r.PostFormValue("token"))
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && rt.ClientID != uuid.NullUUID{UUID: client.ID, Valid: true}) {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if err != nil {
+			respondWithOAuthError(w, err)
+			return
+		}
+		if _, err := cfg.db.RevokeRefreshTokenFamily(r.Context(), database.RevokeRefreshTokenFamilyParams{
+			FamilyID: rt.FamilyID,
+			UserID:   rt.UserID,
+		}); err != nil {
+			respondWithOAuthError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func getUserInfoHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenStr, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusUnauthorized, err)
+			return
+		}
+		token, err := cfg.keys.ValidateAccessToken(tokenStr)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusUnauthorized, err)
+			return
+		}
+		if !token.Allows(auth.ScopeOpenID) {
+			respondWithErrorJSON(w, http.StatusForbidden, errInsufficientScope)
+			return
+		}
+		user, err := cfg.db.GetUserById(r.Context(), token.UserID)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusUnauthorized, err)
+			return
+		}
+		type responseBody struct {
+			Subject       string `json:"sub"`
+			Email         string `json:"email,omitempty"`
+			EmailVerified *bool  `json:"email_verified,omitempty"`
+		}
+		res := responseBody{Subject: user.ID.String()}
+		if token.Allows(auth.ScopeEmail) {
+			verified := user.EmailVerifiedAt.Valid
+			res.Email = user.Email
+			res.EmailVerified = &verified
+		}
+		respondWithJSON(w, http.StatusOK, res)
+	})
+}
+
+func getOpenIDConfigurationHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respondWithJSON(w, http.StatusOK, map[string]any{
+			"issuer":                                         cfg.publicURL,
+			"authorization_endpoint":                         cfg.publicURL + "/oauth/authorize",
+			"token_endpoint":                                 cfg.publicURL + "/oauth/token",
+			"revocation_endpoint":                            cfg.publicURL + "/oauth/revoke",
+			"userinfo_endpoint":                              cfg.publicURL + "/oauth/userinfo",
+			"jwks_uri":                                       cfg.publicURL + "/.well-known/jwks.json",
+			"response_types_supported":                       []string{"code"},
+			"grant_types_supported":                          []string{"authorization_code", "refresh_token"},
+			"subject_types_supported":                        []string{"public"},
+			"id_token_signing_alg_values_supported":          []string{cfg.keys.SigningAlgorithm()},
+			"scopes_supported":                               []auth.Scope{auth.ScopeOpenID, auth.ScopeEmail, auth.ScopeChirpsRead, auth.ScopeChirpsWrite, auth.ScopeProfileWrite},
+			"token_endpoint_auth_methods_supported":          []string{"client_secret_basic", "client_secret_post", "none"},
+			"code_challenge_methods_supported":               []string{auth.PKCEMethodS256},
+			"claims_supported":                               []string{"sub", "iss", "aud", "exp", "iat", "nonce", "email", "email_verified"},
+			"authorization_response_iss_parameter_supported": true,
+		})
+	})
+}
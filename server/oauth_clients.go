@@ -0,0 +1,153 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/auth"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+}
+
+func fromDbOAuthClient(c database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           c.ID,
+		CreatedAt:    c.CreatedAt,
+		Name:         c.Name,
+		RedirectURIs: c.RedirectUris,
+		Scopes:       c.Scopes,
+		Confidential: c.SecretHash.Valid,
+	}
+}
+
+// validateRedirectURI only allows https, plain http is tolerated on loopback for local development.
+func validateRedirectURI(redirectURI string) error {
+	u, err := url.Parse(redirectURI)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+		return fmt.Errorf("Invalid redirect uri %q", redirectURI)
+	}
+	loopback := u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1" || u.Hostname() == "::1"
+	if u.Scheme != "https" && !(u.Scheme == "http" && loopback) {
+		return fmt.Errorf("Redirect uri %q must use https", redirectURI)
+	}
+	return nil
+}
+
+func getCreateOAuthClientHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type requestBody struct {
+			Name         string   `json:"name"`
+			RedirectURIs []string `json:"redirect_uris"`
+			Scopes       []string `json:"scopes"`
+			Confidential bool     `json:"confidential"`
+		}
+		type responseBody struct {
+			OAuthClient
+			ClientSecret string `json:"client_secret,omitempty"`
+		}
+		decoder := json.NewDecoder(r.Body)
+		req := requestBody{}
+		if err := decoder.Decode(&req); err != nil || req.Name == "" || len(req.RedirectURIs) == 0 {
+			respondWithErrorJSON(w, http.StatusBadRequest, fmt.Errorf("Bad request %v", err))
+			return
+		}
+		for _, redirectURI := range req.RedirectURIs {
+			if err := validateRedirectURI(redirectURI); err != nil {
+				respondWithErrorJSON(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		scopes, err := auth.ParseOAuthScopes(strings.Join(req.Scopes, " "))
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusBadRequest, err)
+			return
+		}
+		scopeNames := []string{}
+		for _, scope := range scopes {
+			scopeNames = append(scopeNames, string(scope))
+		}
+		secret := ""
+		secretHash := sql.NullString{}
+		if req.Confidential {
+			secret = auth.MakeRefreshToken()
+			secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+		}
+		client, err := cfg.db.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+			Name:         req.Name,
+			SecretHash:   secretHash,
+			RedirectUris: req.RedirectURIs,
+			Scopes:       scopeNames,
+		})
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		cfg.audit.record(r, cfg.requestActor(r), auditOAuthClientCreate, client.ID.String(), auditSuccess)
+		// The secret is only ever shown in this response.
+		respondWithJSON(w, http.StatusCreated, responseBody{
+			OAuthClient:  fromDbOAuthClient(client),
+			ClientSecret: secret,
+		})
+	})
+}
+
+func getGetOAuthClientsHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clients, err := cfg.db.GetOAuthClients(r.Context())
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		res := []OAuthClient{}
+		for _, client := range clients {
+			res = append(res, fromDbOAuthClient(client))
+		}
+		respondWithJSON(w, http.StatusOK, res)
+	})
+}
+
+var errInvalidOAuthClient = errors.New("Invalid client credentials")
+
+// authenticateOAuthClient accepts client_secret_basic and client_secret_post, public
+// clients only send their id and are bound to their codes through PKCE.
+func authenticateOAuthClient(r *http.Request, cfg *apiConfig) (database.OauthClient, error) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		// RFC 6749 section 2.3.1 form-encodes the credentials before the basic scheme.
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = r.PostFormValue("client_id")
+		secret = r.PostFormValue("client_secret")
+	}
+	id, err := uuid.Parse(clientID)
+	if err != nil {
+		return database.OauthClient{}, errInvalidOAuthClient
+	}
+	client, err := cfg.db.GetOAuthClient(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.OauthClient{}, errInvalidOAuthClient
+	}
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+	if client.SecretHash.Valid && (secret == "" || !auth.CheckTokenHash(secret, client.SecretHash.String)) {
+		return database.OauthClient{}, errInvalidOAuthClient
+	}
+	return client, nil
+}
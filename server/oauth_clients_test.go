@@ -0,0 +1,34 @@
+package server
+
+import "testing"
+
+func TestValidateRedirectURI(t *testing.T) {
+	testCases := map[string]struct {
+		redirectURI string
+		valid       bool
+	}{
+		"https":          {redirectURI: "https://lospolloshermanos.com/callback", valid: true},
+		"http loopback":  {redirectURI: "http://localhost:3000/callback", valid: true},
+		"http remote":    {redirectURI: "http://lospolloshermanos.com/callback", valid: false},
+		"relative":       {redirectURI: "/callback", valid: false},
+		"fragment":       {redirectURI: "https://lospolloshermanos.com/callback#token", valid: false},
+		"custom scheme":  {redirectURI: "javascript://lospolloshermanos.com/%0Aalert(1)", valid: false},
+		"missing host":   {redirectURI: "https:///callback", valid: false},
+		"not a uri":      {redirectURI: "https://[::1", valid: false},
+		"loopback ipv6":  {redirectURI: "http://[::1]:3000/callback", valid: true},
+		"loopback ipv4":  {redirectURI: "http://127.0.0.1:3000/callback", valid: true},
+		"lookalike host": {redirectURI: "http://localhost.lospolloshermanos.com/callback", valid: false},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := validateRedirectURI(test.redirectURI)
+			if err != nil && test.valid {
+				t.Fatalf("Validation failed for %s: %v", test.redirectURI, err)
+			}
+			if err == nil && !test.valid {
+				t.Fatalf("Expected failure for %s", test.redirectURI)
+			}
+		})
+	}
+}
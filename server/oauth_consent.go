@@ -0,0 +1,62 @@
+package server
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/the-1aw/chirpy/internal/auth"
+)
+
+var scopeDescriptions = map[auth.Scope]string{
+	auth.ScopeOpenID:       "Know who you are on Chirpy",
+	auth.ScopeEmail:        "See your email address",
+	auth.ScopeChirpsRead:   "Read chirps",
+	auth.ScopeChirpsWrite:  "Post and delete chirps as you",
+	auth.ScopeProfileWrite: "Change your email and password",
+}
+
+var consentTemplate = template.Must(template.New("consent").Funcs(template.FuncMap{
+	"describe": func(scope auth.Scope) string { return scopeDescriptions[scope] },
+}).Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <meta charset="utf-8">
+    <title>Authorize {{.ClientName}}</title>
+  </head>
+  <body>
+    <h1>{{.ClientName}} wants to access your Chirpy account</h1>
+    <p>Signed in as {{.Email}}. It will be able to:</p>
+    <ul>
+      {{range .Scopes}}<li>{{describe .}}</li>
+      {{end}}
+    </ul>
+    <form method="post" action="/oauth/authorize">
+      {{range $name, $values := .Fields}}{{range $values}}<input type="hidden" name="{{$name}}" value="{{.}}">
+      {{end}}{{end}}
+      <button type="submit" name="decision" value="allow">Allow</button>
+      <button type="submit" name="decision" value="deny">Deny</button>
+    </form>
+  </body>
+</html>
+`))
+
+type consentPage struct {
+	ClientName string
+	Email      string
+	Scopes     []auth.Scope
+	Fields     url.Values
+}
+
+func renderConsentPage(w http.ResponseWriter, page consentPage) {
+	w.Header().Set("content-type", "text/html")
+	// A framed consent page could be clickjacked into granting access.
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if err := consentTemplate.Execute(w, page); err != nil {
+		log.Printf("Failed rendering consent page %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/auth"
+	"github.com/the-1aw/chirpy/internal/database"
+	"github.com/the-1aw/chirpy/internal/mailer"
+)
+
+const passwordResetTokenValidity = time.Hour
+
+// sendPasswordResetEmail returns the id of the account, uuid.Nil when there is none.
+func sendPasswordResetEmail(ctx context.Context, cfg *apiConfig, email string) (uuid.UUID, error) {
+	user, err := cfg.db.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, nil
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	token := auth.MakeRefreshToken()
+	if err := cfg.db.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(passwordResetTokenValidity),
+	}); err != nil {
+		return user.ID, err
+	}
+	return user.ID, cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset your Chirpy password.\n\nUse this token with POST /api/password-reset/confirm within %v:\n\n%s\n\nIf it wasn't you, you can ignore this email.\n",
+			passwordResetTokenValidity,
+			token,
+		),
+	})
+}
+
+func getRequestPasswordResetHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type requestBody struct {
+			Email string `json:"email"`
+		}
+		decoder := json.NewDecoder(r.Body)
+		req := requestBody{}
+		if err := decoder.Decode(&req); err != nil || req.Email == "" {
+			respondWithErrorJSON(w, http.StatusBadRequest, fmt.Errorf("Bad request %v", err))
+			return
+		}
+		// Failures are only logged so the endpoint cannot be used to find out who has an account.
+		uid, err := sendPasswordResetEmail(r.Context(), cfg, req.Email)
+		if err != nil {
+			log.Printf("Failed sending password reset email %v", err)
+		}
+		if uid != uuid.Nil {
+			cfg.audit.record(r, uid, auditPasswordResetRequest, auditEmail(req.Email), auditSuccess)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+func getConfirmPasswordResetHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type requestBody struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+		decoder := json.NewDecoder(r.Body)
+		req := requestBody{}
+		if err := decoder.Decode(&req); err != nil || req.Token == "" || req.Password == "" {
+			respondWithErrorJSON(w, http.StatusBadRequest, fmt.Errorf("Bad request %v", err))
+			return
+		}
+		// The token is only consumed once the new password is accepted so it can be retried.
+		resetToken, err := cfg.db.GetPasswordResetToken(r.Context(), auth.HashToken(req.Token))
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErrorJSON(w, http.StatusUnauthorized, errors.New("Invalid or expired reset token"))
+			return
+		}
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		user, err := cfg.db.GetUserById(r.Context(), resetToken.UserID)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if err := cfg.passwordPolicy.Check(req.Password, user.Email); err != nil {
+			respondWithPasswordError(w, err)
+			return
+		}
+		resetToken, err = cfg.db.ConsumePasswordResetToken(r.Context(), auth.HashToken(req.Token))
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErrorJSON(w, http.StatusUnauthorized, errors.New("Invalid or expired reset token"))
+			return
+		}
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		hashedPassword, err := auth.HashPassword(req.Password)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if err := cfg.db.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+			ID:             resetToken.UserID,
+			HashedPassword: hashedPassword,
+		}); err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if err := cfg.db.InvalidatePasswordResetTokensByUserID(r.Context(), resetToken.UserID); err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		// Whoever knew the old password must not keep a session.
+		if err := cfg.db.RevokeAllRefreshTokensByUserID(r.Context(), resetToken.UserID); err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		cfg.audit.record(r, resetToken.UserID, auditPasswordReset, "", auditSuccess)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -42,6 +42,7 @@ func getPolkaWebhookHandler(cfg *apiConfig) http.Handler {
 			respondWithErrorJSON(w, http.StatusNotFound, err)
 			return
 		}
+		cfg.audit.record(r, event.Data.UserID, auditChirpyRedUpgrade, "polka", auditSuccess)
 		w.WriteHeader(http.StatusNoContent)
 	})
 }
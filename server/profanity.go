@@ -0,0 +1,258 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/profanity"
+)
+
+type profanityAction string
+
+const (
+	profanityMask   = profanityAction("mask")
+	profanityReject = profanityAction("reject")
+	profanityFlag   = profanityAction("flag")
+)
+
+// profaneWordsReloadInterval bounds how long the other instances keep filtering with a
+// list an admin changed.
+const profaneWordsReloadInterval = 30 * time.Second
+
+var errChirpProfane = errors.New("Chirp contains profanity")
+
+// chirpPolicy is what every new chirp is checked against, imported ones included.
+type chirpPolicy struct {
+	maxLength       int
+	profanity       *profanity.Filter
+	profanityAction profanityAction
+	// fileWords come from PROFANITY_WORDS_FILE, admins manage the rest in the database.
+	fileWords []string
+	// editWindow is how long after publishing regular users may edit, Chirpy Red members always can.
+	editWindow time.Duration
+}
+
+// loadChirpPolicy reads CHIRP_MAX_LENGTH, CHIRP_EDIT_WINDOW, PROFANITY_ACTION (mask, reject or flag)
+// and the optional PROFANITY_WORDS_FILE, the database words are added by reloadProfaneWords.
+func loadChirpPolicy() (chirpPolicy, error) {
+	policy := chirpPolicy{
+		maxLength:       defaultChirpMaxLength,
+		profanity:       profanity.NewFilter(nil),
+		profanityAction: profanityMask,
+		editWindow:      defaultChirpEditWindow,
+	}
+	if raw, ok := os.LookupEnv("CHIRP_MAX_LENGTH"); ok {
+		maxLength, err := strconv.Atoi(raw)
+		if err != nil || maxLength <= 0 {
+			return policy, fmt.Errorf("Invalid CHIRP_MAX_LENGTH %q", raw)
+		}
+		policy.maxLength = maxLength
+	}
+	if raw, ok := os.LookupEnv("CHIRP_EDIT_WINDOW"); ok {
+		editWindow, err := time.ParseDuration(raw)
+		if err != nil || editWindow < 0 {
+			return policy, fmt.Errorf("Invalid CHIRP_EDIT_WINDOW %q", raw)
+		}
+		policy.editWindow = editWindow
+	}
+	if raw, ok := os.LookupEnv("PROFANITY_ACTION"); ok {
+		action := profanityAction(raw)
+		if action != profanityMask && action != profanityReject && action != profanityFlag {
+			return policy, fmt.Errorf("Invalid PROFANITY_ACTION %q must be %s, %s or %s", raw, profanityMask, profanityReject, profanityFlag)
+		}
+		policy.profanityAction = action
+	}
+	if path, ok := os.LookupEnv("PROFANITY_WORDS_FILE"); ok {
+		words, err := profanity.LoadWords(path)
+		if err != nil {
+			return policy, err
+		}
+		policy.fileWords = words
+		policy.profanity.SetWords(words)
+	}
+	return policy, nil
+}
+
+// reloadProfaneWords swaps the filter list without a restart, it runs on start, after
+// every admin change on the instance that served it and every profaneWordsReloadInterval.
+func (cfg *apiConfig) reloadProfaneWords(ctx context.Context) error {
+	rows, err := cfg.db.GetProfaneWords(ctx)
+	if err != nil {
+		return err
+	}
+	words := slices.Clone(cfg.chirps.fileWords)
+	for _, row := range rows {
+		words = append(words, row.Word)
+	}
+	cfg.chirps.profanity.SetWords(words)
+	return nil
+}
+
+// runProfaneWordsReload picks up the changes made through other instances, it blocks
+// until ctx is done and is meant to run in its own goroutine.
+func runProfaneWordsReload(ctx context.Context, cfg *apiConfig) {
+	ticker := time.NewTicker(profaneWordsReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := cfg.reloadProfaneWords(ctx); err != nil {
+			log.Printf("Failed reloading profane words %v", err)
+		}
+	}
+}
+
+type ProfaneWord struct {
+	Word      string    `json:"word"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func getGetProfaneWordsHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type responseBody struct {
+			Words []ProfaneWord `json:"words"`
+			// FileWords can only be changed by editing PROFANITY_WORDS_FILE.
+			FileWords []string `json:"file_words"`
+		}
+		rows, err := cfg.db.GetProfaneWords(r.Context())
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		res := responseBody{Words: []ProfaneWord{}, FileWords: cfg.chirps.fileWords}
+		if res.FileWords == nil {
+			res.FileWords = []string{}
+		}
+		for _, row := range rows {
+			res.Words = append(res.Words, ProfaneWord{Word: row.Word, CreatedAt: row.CreatedAt})
+		}
+		respondWithJSON(w, http.StatusOK, res)
+	})
+}
+
+func getAddProfaneWordHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type requestBody struct {
+			Word string `json:"word"`
+		}
+		decoder := json.NewDecoder(r.Body)
+		req := requestBody{}
+		if err := decoder.Decode(&req); err != nil {
+			respondWithErrorJSON(w, http.StatusBadRequest, fmt.Errorf("Bad request %v", err))
+			return
+		}
+		if err := profanity.ValidateWord(req.Word); err != nil {
+			respondWithErrorJSON(w, http.StatusBadRequest, err)
+			return
+		}
+		word := strings.ToLower(req.Word)
+		if err := cfg.db.AddProfaneWord(r.Context(), word); err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if err := cfg.reloadProfaneWords(r.Context()); err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		cfg.audit.record(r, cfg.requestActor(r), auditProfaneWordAdd, word, auditSuccess)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func getDeleteProfaneWordHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		word := strings.ToLower(r.PathValue("word"))
+		deleted, err := cfg.db.DeleteProfaneWord(r.Context(), word)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if deleted == 0 {
+			respondWithErrorJSON(w, http.StatusNotFound, fmt.Errorf("No profane word %q", word))
+			return
+		}
+		if err := cfg.reloadProfaneWords(r.Context()); err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		cfg.audit.record(r, cfg.requestActor(r), auditProfaneWordRemove, word, auditSuccess)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func getGetFlaggedChirpsHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chirpsFromDb, err := cfg.db.GetFlaggedChirps(r.Context())
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		chirps := []Chirp{}
+		for _, c := range chirpsFromDb {
+			chirps = append(chirps, fromDbChirp(c))
+		}
+		respondWithJSON(w, http.StatusOK, chirps)
+	})
+}
+
+func getApproveChirpHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		cleared, err := cfg.db.ClearChirpFlag(r.Context(), chirpID)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if cleared == 0 {
+			respondWithErrorJSON(w, http.StatusNotFound, errors.New("No flagged chirp with this id"))
+			return
+		}
+		cfg.audit.record(r, cfg.requestActor(r), auditChirpApprove, chirpID.String(), auditSuccess)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// getRejectChirpHandler removes a flagged chirp the way its author would have deleted it.
+func getRejectChirpHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		chirp, err := cfg.db.GetChirpByIdIncludingFlagged(r.Context(), chirpID)
+		if err != nil || !chirp.FlaggedAt.Valid {
+			respondWithErrorJSON(w, http.StatusNotFound, errors.New("No flagged chirp with this id"))
+			return
+		}
+		err = deleteChirp(cfg, r, chirpID, chirp.UserID.UUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithErrorJSON(w, http.StatusNotFound, errors.New("No flagged chirp with this id"))
+			return
+		}
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		cfg.audit.record(r, cfg.requestActor(r), auditChirpReject, chirpID.String(), auditSuccess)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
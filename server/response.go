@@ -2,7 +2,10 @@ package server
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func respondWithJSON(w http.ResponseWriter, statusCode int, payload any) error {
@@ -19,3 +22,8 @@ func respondWithJSON(w http.ResponseWriter, statusCode int, payload any) error {
 func respondWithErrorJSON(w http.ResponseWriter, statusCode int, err error) error {
 	return respondWithJSON(w, statusCode, map[string]string{"error": err.Error()})
 }
+
+func respondWithRetryAfter(w http.ResponseWriter, wait time.Duration, err error) error {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return respondWithErrorJSON(w, http.StatusTooManyRequests, err)
+}
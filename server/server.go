@@ -1,20 +1,49 @@
 package server
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/alexedwards/argon2id"
+	"github.com/lib/pq"
+	"github.com/the-1aw/chirpy/internal/auth"
 	"github.com/the-1aw/chirpy/internal/database"
+	"github.com/the-1aw/chirpy/internal/lockout"
+	"github.com/the-1aw/chirpy/internal/mailer"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
-	db             *database.Queries
-	jwtSecret      string
+	// conn is only needed to open transactions, queries go through db.
+	conn           *sql.DB
+	db             database.Querier
+	keys           *auth.KeySet
 	polkaKey       string
+	mailer         mailer.Mailer
+	loginGuard     *loginGuard
+	audit          *auditLog
+	exports        *dataExporter
+	passwordPolicy auth.PasswordPolicy
+	publicURL      string
+	chirps         chirpPolicy
+	// accountDeletionGracePeriod is how long a deleted account can still be restored.
+	accountDeletionGracePeriod time.Duration
+	// requireVerifiedEmail blocks chirp creation until the author verified their email.
+	requireVerifiedEmail bool
+	// unpaginatedChirps keeps GET /api/chirps returning every chirp when no limit or cursor is given.
+	unpaginatedChirps bool
 }
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
@@ -26,6 +55,29 @@ func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	)
 }
 
+// middlewareRequireRole rejects requests whose access token does not grant at least role.
+func (cfg *apiConfig) middlewareRequireRole(role auth.Role, next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			tokenStr, _, err := requestToken(r, accessCookieName)
+			if err != nil {
+				respondWithAuthError(w, err)
+				return
+			}
+			_, tokenRole, err := cfg.keys.ValidateJWTWithRole(tokenStr)
+			if err != nil {
+				respondWithErrorJSON(w, http.StatusUnauthorized, err)
+				return
+			}
+			if !tokenRole.Satisfies(role) {
+				respondWithErrorJSON(w, http.StatusForbidden, fmt.Errorf("Forbidden"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		},
+	)
+}
+
 func (cfg *apiConfig) requestCount(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("content-type", "text/html")
 	w.WriteHeader(http.StatusOK)
@@ -33,8 +85,9 @@ func (cfg *apiConfig) requestCount(w http.ResponseWriter, _ *http.Request) {
   <body>
     <h1>Welcome, Chirpy Admin</h1>
     <p>Chirpy has been visited %d times!</p>
+    <p>Audit events that failed to be recorded: %d</p>
   </body>
-</html>`, cfg.fileserverHits.Load())
+</html>`, cfg.fileserverHits.Load(), cfg.audit.failures.Load())
 }
 
 func (cfg *apiConfig) reset(w http.ResponseWriter, r *http.Request) {
@@ -43,6 +96,7 @@ func (cfg *apiConfig) reset(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	cfg.fileserverHits.Store(0)
+	cfg.db.DeleteAllChirps(r.Context())
 	cfg.db.DeleteAllUsers(r.Context())
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
@@ -54,26 +108,208 @@ func healthz(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
 
+// loadKeySet prefers the PEM keys in JWT_KEYS_DIR and falls back to the HS256 JWT_SECRET.
+// Sending SIGHUP reloads the key directory so keys can be rotated without a restart.
+func loadKeySet() (*auth.KeySet, error) {
+	keysDir, kdOk := os.LookupEnv("JWT_KEYS_DIR")
+	if !kdOk {
+		jwtSecret, jsOk := os.LookupEnv("JWT_SECRET")
+		if !jsOk {
+			return nil, fmt.Errorf("Missing jwt secret")
+		}
+		return auth.NewHMACKeySet(jwtSecret), nil
+	}
+	keys, err := auth.LoadKeySet(keysDir)
+	if err != nil {
+		return nil, err
+	}
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			if err := keys.Reload(); err != nil {
+				log.Printf("Failed reloading jwt keys %v", err)
+			}
+		}
+	}()
+	return keys, nil
+}
+
+// loadMailer sends through SMTP_ADDR when set, otherwise mails are written to MAIL_DIR
+// or printed to stdout so every flow can be exercised locally.
+func loadMailer() (mailer.Mailer, error) {
+	from, ok := os.LookupEnv("MAIL_FROM")
+	if !ok {
+		from = "chirpy@localhost"
+	}
+	if smtpAddr, ok := os.LookupEnv("SMTP_ADDR"); ok {
+		return mailer.NewSMTPMailer(smtpAddr, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+	}
+	if mailDir, ok := os.LookupEnv("MAIL_DIR"); ok {
+		return mailer.NewFileMailer(mailDir, from)
+	}
+	return mailer.NewConsoleMailer(os.Stdout, from), nil
+}
+
+// loadHashParams starts from the argon2id defaults, ARGON2_MEMORY is in KiB.
+// Raising them upgrades existing hashes as users log in.
+func loadHashParams() (*argon2id.Params, error) {
+	params := *argon2id.DefaultParams
+	for name, target := range map[string]*uint32{
+		"ARGON2_MEMORY":     &params.Memory,
+		"ARGON2_ITERATIONS": &params.Iterations,
+	} {
+		if raw, ok := os.LookupEnv(name); ok {
+			value, err := strconv.ParseUint(raw, 10, 32)
+			if err != nil || value == 0 {
+				return nil, fmt.Errorf("Invalid %s %q", name, raw)
+			}
+			*target = uint32(value)
+		}
+	}
+	if raw, ok := os.LookupEnv("ARGON2_PARALLELISM"); ok {
+		value, err := strconv.ParseUint(raw, 10, 8)
+		if err != nil || value == 0 {
+			return nil, fmt.Errorf("Invalid ARGON2_PARALLELISM %q", raw)
+		}
+		params.Parallelism = uint8(value)
+	}
+	return &params, nil
+}
+
+// loadPasswordPolicy starts from auth.DefaultPasswordPolicy, BREACHED_PASSWORDS_FILE points
+// to a list of SHA-1 digests such as the Have I Been Pwned corpus.
+func loadPasswordPolicy() (auth.PasswordPolicy, error) {
+	policy := auth.DefaultPasswordPolicy
+	if raw, ok := os.LookupEnv("PASSWORD_MIN_LENGTH"); ok {
+		minLength, err := strconv.Atoi(raw)
+		if err != nil || minLength < 0 {
+			return policy, fmt.Errorf("Invalid PASSWORD_MIN_LENGTH %q", raw)
+		}
+		policy.MinLength = minLength
+	}
+	if raw, ok := os.LookupEnv("PASSWORD_MIN_ENTROPY"); ok {
+		minEntropy, err := strconv.ParseFloat(raw, 64)
+		if err != nil || minEntropy < 0 {
+			return policy, fmt.Errorf("Invalid PASSWORD_MIN_ENTROPY %q", raw)
+		}
+		policy.MinEntropy = minEntropy
+	}
+	if path, ok := os.LookupEnv("BREACHED_PASSWORDS_FILE"); ok {
+		breached, err := auth.LoadBreachedPasswordList(path)
+		if err != nil {
+			return policy, err
+		}
+		policy.Breached = breached
+	}
+	return policy, nil
+}
+
+// loadAccountDeletionGracePeriod reads ACCOUNT_DELETION_GRACE_PERIOD as a Go duration, e.g. 720h.
+func loadAccountDeletionGracePeriod() (time.Duration, error) {
+	raw, ok := os.LookupEnv("ACCOUNT_DELETION_GRACE_PERIOD")
+	if !ok {
+		return defaultAccountDeletionGracePeriod, nil
+	}
+	gracePeriod, err := time.ParseDuration(raw)
+	if err != nil || gracePeriod < 0 {
+		return 0, fmt.Errorf("Invalid ACCOUNT_DELETION_GRACE_PERIOD %q", raw)
+	}
+	return gracePeriod, nil
+}
+
+// dbTime converts t for the timestamp columns, they have no zone and hold UTC times.
+func dbTime(t time.Time) time.Time {
+	return t.UTC()
+}
+
+// isUniqueViolation reports errors raised by a unique index, usually a race lost to a
+// concurrent request that a where not exists guard could not see.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func openDatabase() (*sql.DB, error) {
+	return sql.Open("postgres", os.Getenv("DB_URL"))
+}
+
 func Run() error {
-	dbUrl := os.Getenv("DB_URL")
-	jwtSecret, jsOk := os.LookupEnv("JWT_SECRET")
-	polkaKey, pkOk := os.LookupEnv("POLKA_KEY")
-	if !jsOk {
-		return fmt.Errorf("Missing jwt secret")
+	keys, err := loadKeySet()
+	if err != nil {
+		return err
+	}
+	hashParams, err := loadHashParams()
+	if err != nil {
+		return err
+	}
+	auth.SetHashParams(hashParams)
+	passwordPolicy, err := loadPasswordPolicy()
+	if err != nil {
+		return err
 	}
+	gracePeriod, err := loadAccountDeletionGracePeriod()
+	if err != nil {
+		return err
+	}
+	chirps, err := loadChirpPolicy()
+	if err != nil {
+		return err
+	}
+	polkaKey, pkOk := os.LookupEnv("POLKA_KEY")
 	if !pkOk {
 		return fmt.Errorf("Missing polka api key")
 	}
-	db, err := sql.Open("postgres", dbUrl)
+	m, err := loadMailer()
 	if err != nil {
 		return err
 	}
-	dbQueries := database.New(db)
+	publicURL, puOk := os.LookupEnv("PUBLIC_URL")
+	if !puOk {
+		publicURL = "http://localhost:8080"
+	}
+	conn, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	dbQueries := database.New(conn)
+	exportDir, edOk := os.LookupEnv("EXPORT_DIR")
+	if !edOk {
+		exportDir = filepath.Join(os.TempDir(), "chirpy-exports")
+	}
+	exports, err := newDataExporter(exportDir)
+	if err != nil {
+		return err
+	}
+	var lockoutStore lockout.Store = lockout.NewPostgresStore(dbQueries)
+	if os.Getenv("LOGIN_LOCKOUT_STORE") == "memory" {
+		lockoutStore = lockout.NewMemoryStore()
+	}
 	cfg := apiConfig{
-		db:        dbQueries,
-		jwtSecret: jwtSecret,
-		polkaKey:  polkaKey,
+		conn:     conn,
+		db:       dbQueries,
+		keys:     keys,
+		polkaKey: polkaKey,
+		mailer:   m,
+
+		loginGuard:           newLoginGuard(lockoutStore),
+		audit:                newAuditLog(dbQueries),
+		exports:              exports,
+		passwordPolicy:       passwordPolicy,
+		publicURL:            strings.TrimSuffix(publicURL, "/"),
+		chirps:               chirps,
+		requireVerifiedEmail: os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true",
+		unpaginatedChirps:    os.Getenv("CHIRPS_UNPAGINATED") == "true",
+
+		accountDeletionGracePeriod: gracePeriod,
+	}
+	if err := cfg.reloadProfaneWords(context.Background()); err != nil {
+		return err
 	}
+	go runAccountPurge(context.Background(), dbQueries, gracePeriod, exports)
+	go runDataExportCleanup(context.Background(), dbQueries)
+	go runProfaneWordsReload(context.Background(), &cfg)
+
 	mux := http.NewServeMux()
 	mux.Handle("/app/", cfg.middlewareMetricsInc(http.StripPrefix("/app/", http.FileServer(http.Dir(".")))))
 
@@ -81,20 +317,73 @@ func Run() error {
 
 	mux.Handle("POST /api/users", getCreateUserHandler(&cfg))
 	mux.Handle("PUT /api/users", getUpdateUserHandler(&cfg))
+	mux.Handle("GET /api/users/verify", getVerifyEmailHandler(&cfg))
+	mux.Handle("POST /api/users/verify", getVerifyEmailHandler(&cfg))
+	mux.Handle("POST /api/users/verify/resend", getResendEmailVerificationHandler(&cfg))
+	mux.Handle("POST /api/users/2fa/enroll", getEnrollTwoFactorHandler(&cfg))
+	mux.Handle("POST /api/users/2fa/confirm", getConfirmTwoFactorHandler(&cfg))
+	mux.Handle("POST /api/users/2fa/disable", getDisableTwoFactorHandler(&cfg))
+	mux.Handle("GET /api/users/me/security-events", getSecurityEventsHandler(&cfg))
+	mux.Handle("DELETE /api/users/me", getDeleteUserHandler(&cfg))
+	mux.Handle("POST /api/users/me/cancel-deletion", getCancelUserDeletionHandler(&cfg))
+	mux.Handle("POST /api/users/me/export", getCreateDataExportHandler(&cfg))
+	mux.Handle("GET /api/users/me/export/{exportID}", getGetDataExportHandler(&cfg))
+	mux.Handle("GET /api/exports/{exportID}/download", getDownloadDataExportHandler(&cfg))
 
 	mux.Handle("POST /api/login", getLoginHandler(&cfg))
+	mux.Handle("POST /api/login/2fa", getLoginTwoFactorHandler(&cfg))
+	mux.Handle("POST /api/login/magic", getRequestMagicLinkHandler(&cfg))
+	mux.Handle("GET /api/login/magic/{token}", getMagicLinkLoginHandler(&cfg))
 	mux.Handle("POST /api/refresh", getRefreshHandler(&cfg))
 	mux.Handle("POST /api/revoke", getRevokeHandler(&cfg))
 
+	mux.Handle("POST /api/password-reset/request", getRequestPasswordResetHandler(&cfg))
+	mux.Handle("POST /api/password-reset/confirm", getConfirmPasswordResetHandler(&cfg))
+
+	mux.Handle("POST /api/tokens", getCreatePersonalAccessTokenHandler(&cfg))
+	mux.Handle("GET /api/tokens", getGetPersonalAccessTokensHandler(&cfg))
+	mux.Handle("DELETE /api/tokens/{tokenID}", getRevokePersonalAccessTokenHandler(&cfg))
+
+	mux.Handle("GET /api/sessions", getGetSessionsHandler(&cfg))
+	mux.Handle("DELETE /api/sessions/{sessionID}", getDeleteSessionHandler(&cfg))
+	mux.Handle("POST /api/sessions/revoke-all", getRevokeAllSessionsHandler(&cfg))
+
 	mux.Handle("POST /api/chirps", getCreateChirpHandler(&cfg))
+	mux.Handle("POST /api/chirps/import", getImportChirpsHandler(&cfg))
 	mux.Handle("GET /api/chirps", getGetChirpsHandler(&cfg))
+	mux.Handle("GET /api/chirps/search", getSearchChirpsHandler(&cfg))
 	mux.Handle("GET /api/chirps/{chirpID}", getGetChirpByIdHandler(&cfg))
+	mux.Handle("PUT /api/chirps/{chirpID}", getUpdateChirpHandler(&cfg))
+	mux.Handle("GET /api/chirps/{chirpID}/revisions", getGetChirpRevisionsHandler(&cfg))
+	mux.Handle("GET /api/chirps/{chirpID}/thread", getGetChirpThreadHandler(&cfg))
+	mux.Handle("POST /api/chirps/{chirpID}/like", getLikeChirpHandler(&cfg, true))
+	mux.Handle("DELETE /api/chirps/{chirpID}/like", getLikeChirpHandler(&cfg, false))
+	mux.Handle("GET /api/chirps/{chirpID}/likes", getGetChirpLikesHandler(&cfg))
 	mux.Handle("DELETE /api/chirps/{chirpID}", getDeleteChirpByIdHandler(&cfg))
+	// Moderators are not admins, their routes stay out of /admin.
+	mux.Handle("GET /api/moderation/chirps", cfg.middlewareRequireRole(auth.RoleModerator, getGetFlaggedChirpsHandler(&cfg)))
+	mux.Handle("POST /api/moderation/chirps/{chirpID}/approve", cfg.middlewareRequireRole(auth.RoleModerator, getApproveChirpHandler(&cfg)))
+	mux.Handle("POST /api/moderation/chirps/{chirpID}/reject", cfg.middlewareRequireRole(auth.RoleModerator, getRejectChirpHandler(&cfg)))
 
 	mux.HandleFunc("GET /api/healthz", healthz)
+	mux.Handle("GET /.well-known/jwks.json", getJWKSHandler(&cfg))
+	mux.Handle("GET /.well-known/openid-configuration", getOpenIDConfigurationHandler(&cfg))
+
+	mux.Handle("GET /oauth/authorize", getAuthorizeHandler(&cfg))
+	mux.Handle("POST /oauth/authorize", getAuthorizeDecisionHandler(&cfg))
+	mux.Handle("POST /oauth/token", getOAuthTokenHandler(&cfg))
+	mux.Handle("POST /oauth/revoke", getOAuthRevokeHandler(&cfg))
+	mux.Handle("GET /oauth/userinfo", getUserInfoHandler(&cfg))
 
-	mux.HandleFunc("GET /admin/metrics", cfg.requestCount)
-	mux.HandleFunc("POST /admin/reset", cfg.reset)
+	mux.Handle("GET /admin/metrics", cfg.middlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(cfg.requestCount)))
+	mux.Handle("POST /admin/reset", cfg.middlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(cfg.reset)))
+	mux.Handle("POST /admin/oauth/clients", cfg.middlewareRequireRole(auth.RoleAdmin, getCreateOAuthClientHandler(&cfg)))
+	mux.Handle("GET /admin/oauth/clients", cfg.middlewareRequireRole(auth.RoleAdmin, getGetOAuthClientsHandler(&cfg)))
+	mux.Handle("GET /admin/audit-events", cfg.middlewareRequireRole(auth.RoleAdmin, getAuditEventsHandler(&cfg)))
+	mux.Handle("DELETE /admin/lockouts/{email}", cfg.middlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(cfg.clearLockout)))
+	mux.Handle("GET /admin/profanity/words", cfg.middlewareRequireRole(auth.RoleAdmin, getGetProfaneWordsHandler(&cfg)))
+	mux.Handle("POST /admin/profanity/words", cfg.middlewareRequireRole(auth.RoleAdmin, getAddProfaneWordHandler(&cfg)))
+	mux.Handle("DELETE /admin/profanity/words/{word}", cfg.middlewareRequireRole(auth.RoleAdmin, getDeleteProfaneWordHandler(&cfg)))
 
 	server := http.Server{
 		Handler: mux,
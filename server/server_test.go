@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/the-1aw/chirpy/internal/auth"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+// memoryQueries stands in for the database in tests, each test file implements the
+// queries it goes through and any other query panics on the nil Querier.
+type memoryQueries struct {
+	database.Querier
+	users         map[uuid.UUID]database.User
+	refreshTokens map[string]database.RefreshToken
+	magicLinks    map[string]database.MagicLinkToken
+	chirps        map[uuid.UUID]database.Chirp
+	likes         map[database.LikeChirpParams]bool
+	auditEvents   []database.CreateAuditEventParams
+	// auditErr fails every CreateAuditEvent when set.
+	auditErr error
+}
+
+func newMemoryQueries(users ...database.User) *memoryQueries {
+	db := &memoryQueries{
+		users:         map[uuid.UUID]database.User{},
+		refreshTokens: map[string]database.RefreshToken{},
+		magicLinks:    map[string]database.MagicLinkToken{},
+		chirps:        map[uuid.UUID]database.Chirp{},
+		likes:         map[database.LikeChirpParams]bool{},
+	}
+	for _, user := range users {
+		db.users[user.ID] = user
+	}
+	return db
+}
+
+func (db *memoryQueries) GetUserById(_ context.Context, id uuid.UUID) (database.User, error) {
+	user, ok := db.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (db *memoryQueries) GetUserByEmail(_ context.Context, email string) (database.User, error) {
+	for _, user := range db.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func TestMiddlewareRequireRole(t *testing.T) {
+	cfg := &apiConfig{keys: auth.NewHMACKeySet("validSecret")}
+	handler := cfg.middlewareRequireRole(auth.RoleAdmin, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	makeToken := func(role auth.Role) string {
+		token, err := cfg.keys.MakeJWT(uuid.New(), role, time.Hour)
+		if err != nil {
+			t.Fatal("Failed due to make jwt (improper test case setup)")
+		}
+		return token
+	}
+	testCases := map[string]struct {
+		authorization string
+		status        int
+	}{
+		"admin":         {authorization: "Bearer " + makeToken(auth.RoleAdmin), status: http.StatusOK},
+		"moderator":     {authorization: "Bearer " + makeToken(auth.RoleModerator), status: http.StatusForbidden},
+		"user":          {authorization: "Bearer " + makeToken(auth.RoleUser), status: http.StatusForbidden},
+		"missing token": {authorization: "", status: http.StatusUnauthorized},
+		"invalid token": {authorization: "Bearer xxx", status: http.StatusUnauthorized},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/metrics", nil)
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != test.status {
+				t.Fatalf("Unexpected status\nexpected: %d\ngot: %d", test.status, rec.Code)
+			}
+		})
+	}
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	testCases := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"unique violation": {err: &pq.Error{Code: "23505"}, expected: true},
+		"wrapped":          {err: fmt.Errorf("Failed creating export %w", &pq.Error{Code: "23505"}), expected: true},
+		"foreign key":      {err: &pq.Error{Code: "23503"}},
+		"no rows":          {err: sql.ErrNoRows},
+		"no error":         {},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if isUniqueViolation(test.err) != test.expected {
+				t.Fatalf("Invalid result for %v\nexpected: %v", test.err, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/auth"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+type clientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+func clientInfoFromRequest(r *http.Request) clientInfo {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return clientInfo{
+		UserAgent: r.UserAgent(),
+		IPAddress: ip,
+	}
+}
+
+// Session is a refresh token family, its ID never exposes the underlying token.
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+}
+
+func fromDbSession(s database.GetActiveSessionsByUserIDRow) Session {
+	return Session{
+		ID:         s.FamilyID,
+		CreatedAt:  s.CreatedAt,
+		ExpiresAt:  s.ExpiresAt,
+		LastUsedAt: s.LastUsedAt,
+		UserAgent:  s.UserAgent,
+		IPAddress:  s.IpAddress,
+	}
+}
+
+func getGetSessionsHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, err := cfg.authenticate(r, auth.ScopeSession)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		sessionsFromDb, err := cfg.db.GetActiveSessionsByUserID(r.Context(), uid)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		sessions := []Session{}
+		for _, s := range sessionsFromDb {
+			sessions = append(sessions, fromDbSession(s))
+		}
+		respondWithJSON(w, http.StatusOK, sessions)
+	})
+}
+
+func getDeleteSessionHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		uid, err := cfg.authenticate(r, auth.ScopeSession)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		revoked, err := cfg.db.RevokeRefreshTokenFamily(r.Context(), database.RevokeRefreshTokenFamilyParams{
+			FamilyID: sessionID,
+			UserID:   uid,
+		})
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if revoked == 0 {
+			respondWithErrorJSON(w, http.StatusNotFound, fmt.Errorf("Session %s not found", sessionID))
+			return
+		}
+		cfg.audit.record(r, uid, auditSessionRevoke, sessionID.String(), auditSuccess)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func getRevokeAllSessionsHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, err := cfg.authenticate(r, auth.ScopeSession)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		if err := cfg.db.RevokeAllRefreshTokensByUserID(r.Context(), uid); err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		cfg.audit.record(r, uid, auditSessionRevokeAll, "", auditSuccess)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/auth"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func fromDbPersonalAccessToken(t database.PersonalAccessToken) PersonalAccessToken {
+	pat := PersonalAccessToken{
+		ID:        t.ID,
+		CreatedAt: t.CreatedAt,
+		Name:      t.Name,
+		Scopes:    t.Scopes,
+	}
+	if t.ExpiresAt.Valid {
+		pat.ExpiresAt = &t.ExpiresAt.Time
+	}
+	if t.LastUsedAt.Valid {
+		pat.LastUsedAt = &t.LastUsedAt.Time
+	}
+	return pat
+}
+
+func getCreatePersonalAccessTokenHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type requestBody struct {
+			Name      string     `json:"name"`
+			Scopes    []string   `json:"scopes"`
+			ExpiresAt *time.Time `json:"expires_at"`
+		}
+		type responseBody struct {
+			PersonalAccessToken
+			Token string `json:"token"`
+		}
+		uid, err := cfg.authenticate(r, auth.ScopeSession)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		decoder := json.NewDecoder(r.Body)
+		req := requestBody{}
+		if err := decoder.Decode(&req); err != nil || req.Name == "" {
+			respondWithErrorJSON(w, http.StatusBadRequest, fmt.Errorf("Bad request %v", err))
+			return
+		}
+		scopes, err := auth.ParseScopes(req.Scopes)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusBadRequest, err)
+			return
+		}
+		expiresAt := sql.NullTime{}
+		if req.ExpiresAt != nil {
+			if !req.ExpiresAt.After(time.Now()) {
+				respondWithErrorJSON(w, http.StatusBadRequest, errors.New("Expiration must be in the future"))
+				return
+			}
+			expiresAt = sql.NullTime{Time: *req.ExpiresAt, Valid: true}
+		}
+		scopeNames := []string{}
+		for _, scope := range scopes {
+			scopeNames = append(scopeNames, string(scope))
+		}
+		token := auth.MakePersonalAccessToken()
+		pat, err := cfg.db.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+			UserID:    uid,
+			Name:      req.Name,
+			TokenHash: auth.HashToken(token),
+			Scopes:    scopeNames,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		cfg.audit.record(r, uid, auditTokenCreate, pat.ID.String(), auditSuccess)
+		// The token itself is only ever shown in this response.
+		respondWithJSON(w, http.StatusCreated, responseBody{
+			PersonalAccessToken: fromDbPersonalAccessToken(pat),
+			Token:               token,
+		})
+	})
+}
+
+func getGetPersonalAccessTokensHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, err := cfg.authenticate(r, auth.ScopeSession)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		tokensFromDb, err := cfg.db.GetPersonalAccessTokensByUserID(r.Context(), uid)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		tokens := []PersonalAccessToken{}
+		for _, t := range tokensFromDb {
+			tokens = append(tokens, fromDbPersonalAccessToken(t))
+		}
+		respondWithJSON(w, http.StatusOK, tokens)
+	})
+}
+
+func getRevokePersonalAccessTokenHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		uid, err := cfg.authenticate(r, auth.ScopeSession)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		revoked, err := cfg.db.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+			ID:     tokenID,
+			UserID: uid,
+		})
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if revoked == 0 {
+			respondWithErrorJSON(w, http.StatusNotFound, fmt.Errorf("Token %s not found", tokenID))
+			return
+		}
+		cfg.audit.record(r, uid, auditTokenRevoke, tokenID.String(), auditSuccess)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
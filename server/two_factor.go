@@ -0,0 +1,280 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/the-1aw/chirpy/internal/auth"
+	"github.com/the-1aw/chirpy/internal/database"
+)
+
+var errInvalidTwoFactorCode = errors.New("Invalid two-factor code")
+
+type twoFactorRequestBody struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// checkTOTPCode burns the matched step so the same code cannot be used twice.
+func checkTOTPCode(ctx context.Context, cfg *apiConfig, user database.User, code string) error {
+	if !user.TotpSecret.Valid {
+		return errInvalidTwoFactorCode
+	}
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, code, time.Now())
+	if !ok {
+		return errInvalidTwoFactorCode
+	}
+	used, err := cfg.db.UseTOTPStep(ctx, database.UseTOTPStepParams{
+		ID:               user.ID,
+		TotpLastUsedStep: step,
+	})
+	if err != nil {
+		return err
+	}
+	if used == 0 {
+		return errInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func checkRecoveryCode(ctx context.Context, cfg *apiConfig, user database.User, code string) error {
+	codes, err := cfg.db.GetUnusedRecoveryCodesByUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, recoveryCode := range codes {
+		if matches, err := auth.CheckPasswordHash(code, recoveryCode.CodeHash); err != nil || !matches {
+			continue
+		}
+		used, err := cfg.db.UseRecoveryCode(ctx, recoveryCode.ID)
+		if err != nil {
+			return err
+		}
+		if used == 0 {
+			return errInvalidTwoFactorCode
+		}
+		return nil
+	}
+	return errInvalidTwoFactorCode
+}
+
+func replaceRecoveryCodes(ctx context.Context, cfg *apiConfig, userID uuid.UUID) ([]string, error) {
+	if err := cfg.db.DeleteRecoveryCodesByUserID(ctx, userID); err != nil {
+		return nil, err
+	}
+	codes := auth.GenerateRecoveryCodes()
+	for _, code := range codes {
+		hash, err := auth.HashPassword(code)
+		if err != nil {
+			return nil, err
+		}
+		if err := cfg.db.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: hash,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+func respondWithTwoFactorError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		respondWithErrorJSON(w, http.StatusUnauthorized, err)
+		return
+	}
+	respondWithErrorJSON(w, http.StatusInternalServerError, err)
+}
+
+func getEnrollTwoFactorHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, err := cfg.authenticate(r, auth.ScopeSession)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		user, err := cfg.db.GetUserById(r.Context(), uid)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		if user.TotpEnabledAt.Valid {
+			respondWithErrorJSON(w, http.StatusConflict, errors.New("Two-factor authentication already enabled"))
+			return
+		}
+		secret := auth.GenerateTOTPSecret()
+		if err := cfg.db.SetUserPendingTOTPSecret(r.Context(), database.SetUserPendingTOTPSecretParams{
+			ID:         uid,
+			TotpSecret: sql.NullString{String: secret, Valid: true},
+		}); err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, struct {
+			Secret     string `json:"secret"`
+			OTPAuthURI string `json:"otpauth_uri"`
+		}{
+			Secret:     secret,
+			OTPAuthURI: auth.TOTPURI(secret, user.Email),
+		})
+	})
+}
+
+func getConfirmTwoFactorHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, err := cfg.authenticate(r, auth.ScopeSession)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		decoder := json.NewDecoder(r.Body)
+		req := twoFactorRequestBody{}
+		if err := decoder.Decode(&req); err != nil || req.Code == "" {
+			respondWithErrorJSON(w, http.StatusBadRequest, fmt.Errorf("Bad request %v", err))
+			return
+		}
+		user, err := cfg.db.GetUserById(r.Context(), uid)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		if user.TotpEnabledAt.Valid {
+			respondWithErrorJSON(w, http.StatusConflict, errors.New("Two-factor authentication already enabled"))
+			return
+		}
+		if !user.TotpSecret.Valid {
+			respondWithErrorJSON(w, http.StatusBadRequest, errors.New("Two-factor enrollment was not started"))
+			return
+		}
+		step, ok := auth.ValidateTOTP(user.TotpSecret.String, req.Code, time.Now())
+		if !ok {
+			respondWithErrorJSON(w, http.StatusUnauthorized, errInvalidTwoFactorCode)
+			return
+		}
+		if err := cfg.db.EnableUserTOTP(r.Context(), database.EnableUserTOTPParams{
+			ID:               uid,
+			TotpLastUsedStep: step,
+		}); err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		codes, err := replaceRecoveryCodes(r.Context(), cfg, uid)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		cfg.audit.record(r, uid, auditTwoFactorEnable, auditEmail(user.Email), auditSuccess)
+		respondWithJSON(w, http.StatusOK, struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		}{
+			RecoveryCodes: codes,
+		})
+	})
+}
+
+func getDisableTwoFactorHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, err := cfg.authenticate(r, auth.ScopeSession)
+		if err != nil {
+			respondWithAuthError(w, err)
+			return
+		}
+		decoder := json.NewDecoder(r.Body)
+		req := twoFactorRequestBody{}
+		if err := decoder.Decode(&req); err != nil || req.Code == "" {
+			respondWithErrorJSON(w, http.StatusBadRequest, fmt.Errorf("Bad request %v", err))
+			return
+		}
+		user, err := cfg.db.GetUserById(r.Context(), uid)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusNotFound, err)
+			return
+		}
+		if !user.TotpEnabledAt.Valid {
+			respondWithErrorJSON(w, http.StatusConflict, errors.New("Two-factor authentication is not enabled"))
+			return
+		}
+		if err := checkTOTPCode(r.Context(), cfg, user, req.Code); err != nil {
+			cfg.audit.record(r, uid, auditTwoFactorDisable, auditEmail(user.Email), auditFailure)
+			respondWithTwoFactorError(w, err)
+			return
+		}
+		if err := cfg.db.DisableUserTOTP(r.Context(), uid); err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if err := cfg.db.DeleteRecoveryCodesByUserID(r.Context(), uid); err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		cfg.audit.record(r, uid, auditTwoFactorDisable, auditEmail(user.Email), auditSuccess)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func getLoginTwoFactorHandler(cfg *apiConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type requestBody struct {
+			twoFactorRequestBody
+			MFAToken   string `json:"mfa_token"`
+			UseCookies bool   `json:"use_cookies"`
+		}
+		decoder := json.NewDecoder(r.Body)
+		req := requestBody{}
+		if err := decoder.Decode(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+			respondWithErrorJSON(w, http.StatusBadRequest, fmt.Errorf("Bad request %v", err))
+			return
+		}
+		uid, err := cfg.keys.ValidateMFAToken(req.MFAToken)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusUnauthorized, err)
+			return
+		}
+		user, err := cfg.db.GetUserById(r.Context(), uid)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusUnauthorized, err)
+			return
+		}
+		if !user.TotpEnabledAt.Valid {
+			respondWithErrorJSON(w, http.StatusUnauthorized, errors.New("Two-factor authentication is not enabled"))
+			return
+		}
+		client := clientInfoFromRequest(r)
+		wait, err := cfg.loginGuard.retryAfter(r.Context(), user.Email, client)
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
+		if wait > 0 {
+			respondWithRetryAfter(w, wait, errTooManyLoginAttempts)
+			return
+		}
+		if req.Code != "" {
+			err = checkTOTPCode(r.Context(), cfg, user, req.Code)
+		} else {
+			err = checkRecoveryCode(r.Context(), cfg, user, req.RecoveryCode)
+		}
+		if errors.Is(err, errInvalidTwoFactorCode) {
+			if err := cfg.loginGuard.fail(r.Context(), user.Email, client); err != nil {
+				log.Printf("Failed recording login failure %v", err)
+			}
+			cfg.audit.record(r, user.ID, auditTwoFactorLogin, auditEmail(user.Email), auditFailure)
+		}
+		if err != nil {
+			respondWithTwoFactorError(w, err)
+			return
+		}
+		if err := cfg.loginGuard.succeed(r.Context(), user.Email); err != nil {
+			log.Printf("Failed clearing login failures %v", err)
+		}
+		cfg.audit.record(r, user.ID, auditTwoFactorLogin, auditEmail(user.Email), auditSuccess)
+		respondWithLoginTokens(w, r, cfg, user, req.UseCookies)
+	})
+}
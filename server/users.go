@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 
@@ -13,21 +14,33 @@ import (
 )
 
 type User struct {
-	ID          uuid.UUID `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ID              uuid.UUID  `json:"id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	Email           string     `json:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	IsChirpyRed     bool       `json:"is_chirpy_red"`
+	Role            string     `json:"role"`
+	// DeletionRequestedAt is only set while the account is pending deletion.
+	DeletionRequestedAt *time.Time `json:"deletion_requested_at,omitempty"`
 }
 
 func fromDbUser(u database.User) User {
-	return User{
+	user := User{
 		ID:          u.ID,
 		CreatedAt:   u.CreatedAt,
 		UpdatedAt:   u.UpdatedAt,
 		Email:       u.Email,
 		IsChirpyRed: u.IsChirpyRed,
+		Role:        u.Role,
 	}
+	if u.EmailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &u.EmailVerifiedAt.Time
+	}
+	if u.DeletionRequestedAt.Valid {
+		user.DeletionRequestedAt = &u.DeletionRequestedAt.Time
+	}
+	return user
 }
 
 type UserContent struct {
@@ -35,6 +48,22 @@ type UserContent struct {
 	Password string `json:"password"`
 }
 
+// respondWithPasswordError details which rules failed when the password policy rejected it.
+func respondWithPasswordError(w http.ResponseWriter, err error) {
+	policyErr := &auth.PasswordPolicyError{}
+	if !errors.As(err, &policyErr) {
+		respondWithErrorJSON(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondWithJSON(w, http.StatusBadRequest, struct {
+		Error      string                   `json:"error"`
+		Violations []auth.PasswordViolation `json:"violations"`
+	}{
+		Error:      policyErr.Error(),
+		Violations: policyErr.Violations,
+	})
+}
+
 func getCreateUserHandler(cfg *apiConfig) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		decoder := json.NewDecoder(r.Body)
@@ -43,14 +72,23 @@ func getCreateUserHandler(cfg *apiConfig) http.Handler {
 			respondWithErrorJSON(w, http.StatusInternalServerError, err)
 			return
 		}
-		if len(req.Password) == 0 {
-			respondWithErrorJSON(w, http.StatusBadRequest, errors.New("Password is required"))
+		if err := validateEmail(req.Email); err != nil {
+			respondWithErrorJSON(w, http.StatusBadRequest, err)
 			return
 		}
-		hashed_password, err := auth.HashPassword(req.Password)
-		if err != nil {
-			respondWithErrorJSON(w, http.StatusInternalServerError, err)
-			return
+		// Without a password the account can only log in through magic links.
+		hashed_password := noPassword
+		if len(req.Password) > 0 {
+			if err := cfg.passwordPolicy.Check(req.Password, req.Email); err != nil {
+				respondWithPasswordError(w, err)
+				return
+			}
+			var err error
+			hashed_password, err = auth.HashPassword(req.Password)
+			if err != nil {
+				respondWithErrorJSON(w, http.StatusInternalServerError, err)
+				return
+			}
 		}
 		user, err := cfg.db.CreateUser(r.Context(), database.CreateUserParams{
 			Email:          req.Email,
@@ -60,6 +98,10 @@ func getCreateUserHandler(cfg *apiConfig) http.Handler {
 			respondWithErrorJSON(w, http.StatusInternalServerError, err)
 			return
 		}
+		cfg.audit.record(r, user.ID, auditUserCreate, auditEmail(user.Email), auditSuccess)
+		if err := sendEmailVerification(r.Context(), cfg, user); err != nil {
+			log.Printf("Failed sending verification email %v", err)
+		}
 		respondWithJSON(w, http.StatusCreated, fromDbUser(user))
 	})
 }
@@ -67,30 +109,76 @@ func getCreateUserHandler(cfg *apiConfig) http.Handler {
 func getUpdateUserHandler(cfg *apiConfig) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		decoder := json.NewDecoder(r.Body)
-		uid, err := auth.ValidateJWTFromHeader(r.Header, cfg.jwtSecret)
+		uid, err := cfg.authenticate(r, auth.ScopeProfileWrite)
 		if err != nil {
-			respondWithErrorJSON(w, http.StatusUnauthorized, err)
+			respondWithAuthError(w, err)
+			return
 		}
 		body := UserContent{}
 		if err := decoder.Decode(&body); err != nil || body.Email == "" || body.Password == "" {
 			respondWithErrorJSON(w, http.StatusBadRequest, fmt.Errorf("Bad request %v\n", err))
 			return
 		}
-		hashed_password, err := auth.HashPassword(body.Password)
+		if err := validateEmail(body.Email); err != nil {
+			respondWithErrorJSON(w, http.StatusBadRequest, err)
+			return
+		}
+		previous, err := cfg.db.GetUserById(r.Context(), uid)
 		if err != nil {
-			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			respondWithErrorJSON(w, http.StatusNotFound, err)
 			return
 		}
+		// The whole profile is replaced, a single hash check tells whether the password
+		// actually changes so unchanged passwords are neither hashed again nor audited.
+		samePassword, err := auth.CheckPasswordHash(body.Password, previous.HashedPassword)
+		samePassword = err == nil && samePassword
+		// Delegated tokens may edit the profile but never the credentials, otherwise a leaked
+		// profile:write token would be enough to take the account over.
+		if !samePassword || body.Email != previous.Email {
+			if _, err := cfg.authenticate(r, auth.ScopeSession); err != nil {
+				respondWithAuthError(w, err)
+				return
+			}
+		}
+		// Like password resets the policy only applies to new passwords, a password that
+		// predates it must not prevent changing the email alone.
+		if !samePassword {
+			if err := cfg.passwordPolicy.Check(body.Password, body.Email); err != nil {
+				respondWithPasswordError(w, err)
+				return
+			}
+		}
+		hashed_password := previous.HashedPassword
+		if !samePassword || auth.NeedsRehash(previous.HashedPassword) {
+			hashed_password, err = auth.HashPassword(body.Password)
+			if err != nil {
+				respondWithErrorJSON(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
 		err = cfg.db.UpdateUserById(r.Context(), database.UpdateUserByIdParams{
 			ID:             uid,
 			Email:          body.Email,
 			HashedPassword: hashed_password,
 		})
+		if err != nil {
+			respondWithErrorJSON(w, http.StatusInternalServerError, err)
+			return
+		}
 		user, err := cfg.db.GetUserByEmail(r.Context(), body.Email)
 		if err != nil {
 			respondWithErrorJSON(w, http.StatusInternalServerError, err)
 			return
 		}
+		if !samePassword {
+			cfg.audit.record(r, uid, auditPasswordChange, "", auditSuccess)
+		}
+		if user.Email != previous.Email {
+			cfg.audit.record(r, uid, auditEmailChange, auditEmail(previous.Email)+" -> "+auditEmail(user.Email), auditSuccess)
+			if err := sendEmailVerification(r.Context(), cfg, user); err != nil {
+				log.Printf("Failed sending verification email %v", err)
+			}
+		}
 		respondWithJSON(w, http.StatusOK, fromDbUser(user))
 	})
 }
@@ -0,0 +1,24 @@
+-- name: CreateAuditEvent :exec
+insert into audit_events(actor_id, action, target, ip_address, user_agent, outcome)
+values ($1, $2, $3, $4, $5, $6);
+
+-- name: GetAuditEventsByActorID :many
+select * from audit_events
+where actor_id = $1
+order by created_at desc
+limit $2;
+
+-- name: GetAuditEvents :many
+select * from audit_events
+where (sqlc.narg(actor_id)::uuid is null or actor_id = sqlc.narg(actor_id))
+	and (sqlc.narg(action)::text is null or action = sqlc.narg(action))
+	and (sqlc.narg(outcome)::text is null or outcome = sqlc.narg(outcome))
+	and (sqlc.narg(since)::timestamp is null or created_at >= sqlc.narg(since))
+	and (sqlc.narg(until)::timestamp is null or created_at < sqlc.narg(until))
+order by created_at desc
+limit sqlc.arg(max_results);
+
+-- name: GetAllAuditEventsByActorID :many
+select * from audit_events
+where actor_id = $1
+order by created_at;
@@ -0,0 +1,28 @@
+-- name: LikeChirp :execrows
+-- Liking twice is a no-op, the primary key keeps one like per user and chirp.
+insert into chirp_likes (user_id, chirp_id)
+values ($1, $2)
+on conflict (user_id, chirp_id) do nothing;
+
+-- name: UnlikeChirp :execrows
+delete from chirp_likes
+where user_id = $1 and chirp_id = $2;
+
+-- name: GetChirpLikes :many
+-- Newest likes first, the cursor is the (created_at, user_id) of the last like of the previous page.
+-- Likes of accounts pending deletion are left out, like_count doesn't count them either.
+select chirp_likes.* from chirp_likes
+join users on users.id = chirp_likes.user_id
+where chirp_likes.chirp_id = sqlc.arg(chirp_id)
+	and users.deletion_requested_at is null
+	and (
+		sqlc.narg(cursor_created_at)::timestamp is null
+		or (chirp_likes.created_at, chirp_likes.user_id) < (sqlc.narg(cursor_created_at), sqlc.narg(cursor_user_id)::uuid)
+	)
+order by chirp_likes.created_at desc, chirp_likes.user_id desc
+limit sqlc.arg(max_results);
+
+-- name: GetLikedChirpIDs :many
+-- Tells which of chirp_ids the user liked, used to fill liked_by_me on a whole page at once.
+select chirp_id from chirp_likes
+where user_id = sqlc.arg(user_id) and chirp_id = any(sqlc.arg(chirp_ids)::uuid[]);
@@ -0,0 +1,16 @@
+-- name: CreateChirpRevision :one
+-- Saves the current body before an edit, the row lock keeps concurrent edits in order.
+insert into chirp_revisions (chirp_id, body, created_at)
+select id, body, updated_at from chirps
+where id = $1
+for update
+returning *;
+
+-- name: GetChirpRevisions :many
+select * from chirp_revisions
+where chirp_id = $1
+order by created_at desc;
+
+-- name: DeleteChirpRevisions :exec
+delete from chirp_revisions
+where chirp_id = $1;
@@ -1,24 +1,187 @@
 -- name: CreateChirp :one
-insert into chirps (user_id, body)
-values ($1, $2)
+insert into chirps (user_id, body, flagged_at, reply_to_id)
+values (
+	sqlc.arg(user_id)::uuid,
+	sqlc.arg(body),
+	case when sqlc.arg(flagged)::boolean then current_timestamp end,
+	sqlc.narg(reply_to_id)
+)
+returning *;
+
+-- name: ImportChirp :one
+-- Chirps already imported under the same external id are skipped and return no row.
+insert into chirps (user_id, body, created_at, updated_at, external_id, flagged_at)
+values (
+	sqlc.arg(user_id)::uuid,
+	sqlc.arg(body),
+	sqlc.arg(created_at),
+	sqlc.arg(created_at),
+	sqlc.arg(external_id),
+	case when sqlc.arg(flagged)::boolean then current_timestamp end
+)
+on conflict (user_id, external_id) where external_id is not null do nothing
 returning *;
 
 -- name: GetChirps :many
-select * from chirps
-order by created_at;
+-- Chirps of accounts pending deletion are hidden until the deletion is cancelled and
+-- flagged chirps until a moderator approves them, tombstones only show up in threads.
+select chirps.* from chirps
+join users on users.id = chirps.user_id
+where users.deletion_requested_at is null and chirps.deleted_at is null and chirps.flagged_at is null
+order by chirps.created_at;
 
 -- name: GetChirpsByAuthorID :many
-select * from chirps
-where user_id = $1
-order by created_at;
+select chirps.* from chirps
+join users on users.id = chirps.user_id
+where chirps.user_id = sqlc.arg(user_id)::uuid and users.deletion_requested_at is null
+	and chirps.deleted_at is null and chirps.flagged_at is null
+order by chirps.created_at;
+
+-- name: GetChirpsPageAsc :many
+-- The cursor is the (created_at, id) of the last chirp of the previous page.
+select chirps.* from chirps
+join users on users.id = chirps.user_id
+where users.deletion_requested_at is null and chirps.deleted_at is null and chirps.flagged_at is null
+	and (sqlc.narg(author_id)::uuid is null or chirps.user_id = sqlc.narg(author_id))
+	and (
+		sqlc.narg(cursor_created_at)::timestamp is null
+		or (chirps.created_at, chirps.id) > (sqlc.narg(cursor_created_at), sqlc.narg(cursor_id)::uuid)
+	)
+order by chirps.created_at, chirps.id
+limit sqlc.arg(max_results);
+
+-- name: GetChirpsPageDesc :many
+select chirps.* from chirps
+join users on users.id = chirps.user_id
+where users.deletion_requested_at is null and chirps.deleted_at is null and chirps.flagged_at is null
+	and (sqlc.narg(author_id)::uuid is null or chirps.user_id = sqlc.narg(author_id))
+	and (
+		sqlc.narg(cursor_created_at)::timestamp is null
+		or (chirps.created_at, chirps.id) < (sqlc.narg(cursor_created_at), sqlc.narg(cursor_id)::uuid)
+	)
+order by chirps.created_at desc, chirps.id desc
+limit sqlc.arg(max_results);
 
 -- name: GetChirpById :one
-select * from chirps
-where id = $1;
+select chirps.* from chirps
+join users on users.id = chirps.user_id
+where chirps.id = $1 and users.deletion_requested_at is null and chirps.deleted_at is null and chirps.flagged_at is null;
+
+-- name: GetChirpByIdIncludingFlagged :one
+-- Flagged chirps stay reachable by their author and by moderators.
+select chirps.* from chirps
+join users on users.id = chirps.user_id
+where chirps.id = $1 and users.deletion_requested_at is null and chirps.deleted_at is null;
+
+-- name: GetThreadChirp :one
+-- Unlike GetChirpById tombstones and hidden chirps are returned, a thread can still be
+-- opened from them.
+select chirps.*, users.deletion_requested_at is not null or chirps.flagged_at is not null as hidden
+from chirps
+left join users on users.id = chirps.user_id
+where chirps.id = $1;
+
+-- name: GetChirpAncestors :many
+-- Walks up the reply chain from the chirp, the root comes first. Tombstones and hidden
+-- chirps are kept so the chain has no holes, hidden tells them apart.
+with recursive ancestors as (
+	select parent.*, 1 as depth from chirps
+	join chirps parent on parent.id = chirps.reply_to_id
+	where chirps.id = sqlc.arg(id)
+	union all
+	select parent.*, ancestors.depth + 1 from ancestors
+	join chirps parent on parent.id = ancestors.reply_to_id
+	where ancestors.depth < sqlc.arg(max_depth)::integer
+)
+select ancestors.*, users.deletion_requested_at is not null or ancestors.flagged_at is not null as hidden
+from ancestors
+left join users on users.id = ancestors.user_id
+order by ancestors.depth desc;
+
+-- name: GetChirpDescendants :many
+-- Replies are read breadth first so max_results cuts the deepest replies first.
+with recursive descendants as (
+	select chirps.*, 1 as depth from chirps
+	where chirps.reply_to_id = sqlc.arg(id)
+	union all
+	select chirps.*, descendants.depth + 1 from descendants
+	join chirps on chirps.reply_to_id = descendants.id
+	where descendants.depth < sqlc.arg(max_depth)::integer
+)
+select descendants.*, users.deletion_requested_at is not null or descendants.flagged_at is not null as hidden
+from descendants
+left join users on users.id = descendants.user_id
+order by descendants.depth, descendants.created_at, descendants.id
+limit sqlc.arg(max_results);
+
+-- name: LockChirp :one
+-- Taken before choosing between TombstoneChirp and DeleteChirp, a reply being inserted
+-- holds a key share lock on its parent so either one waits for the other.
+select id from chirps
+where id = sqlc.arg(id) and user_id = sqlc.arg(user_id)::uuid and deleted_at is null
+for update;
 
 -- name: DeleteChirp :exec
 delete from chirps
-where id = $1 and user_id = $2;
+where id = sqlc.arg(id) and user_id = sqlc.arg(user_id)::uuid;
+
+-- name: TombstoneChirp :execrows
+-- Chirps with replies are emptied instead of deleted, the others are left to DeleteChirp.
+update chirps
+set body = '',
+	updated_at = current_timestamp,
+	deleted_at = current_timestamp,
+	flagged_at = null
+where id = sqlc.arg(id) and user_id = sqlc.arg(user_id)::uuid and deleted_at is null
+	and exists (select 1 from chirps replies where replies.reply_to_id = chirps.id);
 
 -- name: DeleteAllChirps :exec
 delete from chirps;
+
+-- name: GetAllChirpsByAuthorID :many
+-- Hidden chirps are included, this is only meant for data exports.
+select * from chirps
+where user_id = sqlc.arg(user_id)::uuid and deleted_at is null
+order by created_at;
+
+-- name: GetFlaggedChirps :many
+select * from chirps
+where flagged_at is not null
+order by flagged_at;
+
+-- name: ClearChirpFlag :execrows
+update chirps
+set flagged_at = null
+where id = $1 and flagged_at is not null;
+
+-- name: SearchChirps :many
+-- Results are ranked, the cursor is the (rank, created_at, id) of the last result of the previous page.
+select
+	id, created_at, updated_at, body, user_id, edited_at, reply_to_id, reply_count, like_count, rank,
+	ts_headline('english', body, to_tsquery('english', sqlc.arg(query)::text), sqlc.arg(headline_options)::text) as snippet
+from (
+	select
+		chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.edited_at,
+		chirps.reply_to_id, chirps.reply_count, chirps.like_count,
+		ts_rank_cd(chirps.search_vector, to_tsquery('english', sqlc.arg(query)::text))::real as rank
+	from chirps
+	join users on users.id = chirps.user_id
+	where chirps.search_vector @@ to_tsquery('english', sqlc.arg(query)::text)
+		and users.deletion_requested_at is null
+		and chirps.flagged_at is null
+		and (sqlc.narg(author_id)::uuid is null or chirps.user_id = sqlc.narg(author_id))
+) matches
+where sqlc.narg(cursor_rank)::real is null
+	or (rank, created_at, id) < (sqlc.narg(cursor_rank), sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid)
+order by rank desc, created_at desc, id desc
+limit sqlc.arg(max_results);
+
+-- name: UpdateChirpBody :one
+-- An edit is checked again by the profanity filter, a flag is kept only if the new body still needs it.
+update chirps
+set body = sqlc.arg(body),
+	updated_at = current_timestamp,
+	edited_at = current_timestamp,
+	flagged_at = case when sqlc.arg(flagged)::boolean then coalesce(flagged_at, current_timestamp) end
+where id = sqlc.arg(id) and user_id = sqlc.arg(user_id)::uuid and deleted_at is null
+returning *;
@@ -0,0 +1,47 @@
+-- name: CreateDataExport :one
+insert into data_exports(user_id)
+select sqlc.arg(user_id)::uuid
+where not exists (
+	select 1 from data_exports
+	where user_id = sqlc.arg(user_id)::uuid and status = 'pending'
+)
+returning *;
+
+-- name: GetDataExport :one
+select * from data_exports
+where id = $1 and user_id = $2;
+
+-- name: GetLatestDataExport :one
+select * from data_exports
+where user_id = $1
+order by created_at desc
+limit 1;
+
+-- name: GetDataExportById :one
+select * from data_exports
+where id = $1;
+
+-- name: CompleteDataExport :exec
+update data_exports
+set status = 'completed', file_path = $2, expires_at = $3, updated_at = current_timestamp
+where id = $1;
+
+-- name: FailDataExport :exec
+update data_exports
+set status = 'failed', error = $2, updated_at = current_timestamp
+where id = $1;
+
+-- name: TouchDataExport :exec
+update data_exports
+set heartbeat_at = current_timestamp
+where id = $1 and status = 'pending';
+
+-- name: FailStaleDataExports :execrows
+update data_exports
+set status = 'failed', error = 'Interrupted by a server restart', updated_at = current_timestamp
+where status = 'pending' and heartbeat_at < $1;
+
+-- name: DeleteExpiredDataExports :many
+delete from data_exports
+where expires_at < current_timestamp
+returning file_path;
@@ -0,0 +1,15 @@
+-- name: CreateEmailVerificationToken :exec
+insert into email_verification_tokens(token_hash, user_id, email, expires_at)
+values ($1, $2, $3, $4);
+
+-- name: ConsumeEmailVerificationToken :one
+update email_verification_tokens
+set used_at = current_timestamp
+where token_hash = $1 and used_at is null and expires_at > current_timestamp
+returning *;
+
+-- name: GetLatestEmailVerificationTokenByUserID :one
+select * from email_verification_tokens
+where user_id = $1
+order by created_at desc
+limit 1;
@@ -0,0 +1,19 @@
+-- name: GetLoginFailure :one
+select * from login_failures
+where key = $1;
+
+-- name: RecordLoginFailure :one
+insert into login_failures(key, failures, last_failure_at)
+values (sqlc.arg(key), 1, sqlc.arg(failed_at))
+on conflict (key) do update
+set
+	failures = case
+		when login_failures.last_failure_at < sqlc.arg(window_start) then 1
+		else login_failures.failures + 1
+	end,
+	last_failure_at = excluded.last_failure_at
+returning *;
+
+-- name: DeleteLoginFailure :exec
+delete from login_failures
+where key = $1;
@@ -0,0 +1,9 @@
+-- name: CreateMagicLinkToken :exec
+insert into magic_link_tokens(token_hash, user_id, email, expires_at)
+values ($1, $2, $3, $4);
+
+-- name: ConsumeMagicLinkToken :one
+update magic_link_tokens
+set used_at = current_timestamp
+where token_hash = $1 and used_at is null and expires_at > current_timestamp
+returning *;
@@ -0,0 +1,22 @@
+-- name: CreateOAuthClient :one
+insert into oauth_clients(name, secret_hash, redirect_uris, scopes)
+values ($1, $2, $3, $4)
+returning *;
+
+-- name: GetOAuthClient :one
+select * from oauth_clients
+where id = $1;
+
+-- name: GetOAuthClients :many
+select * from oauth_clients
+order by created_at asc;
+
+-- name: CreateOAuthAuthorizationCode :exec
+insert into oauth_authorization_codes(code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, nonce, expires_at)
+values ($1, $2, $3, $4, $5, $6, $7, $8);
+
+-- name: ConsumeOAuthAuthorizationCode :one
+update oauth_authorization_codes
+set used_at = current_timestamp
+where code_hash = $1 and client_id = $2 and used_at is null and expires_at > current_timestamp
+returning *;
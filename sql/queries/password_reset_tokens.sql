@@ -0,0 +1,18 @@
+-- name: CreatePasswordResetToken :exec
+insert into password_reset_tokens(token_hash, user_id, expires_at)
+values ($1, $2, $3);
+
+-- name: GetPasswordResetToken :one
+select * from password_reset_tokens
+where token_hash = $1 and used_at is null and expires_at > current_timestamp;
+
+-- name: ConsumePasswordResetToken :one
+update password_reset_tokens
+set used_at = current_timestamp
+where token_hash = $1 and used_at is null and expires_at > current_timestamp
+returning *;
+
+-- name: InvalidatePasswordResetTokensByUserID :exec
+update password_reset_tokens
+set used_at = current_timestamp
+where user_id = $1 and used_at is null;
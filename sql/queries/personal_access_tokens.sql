@@ -0,0 +1,27 @@
+-- name: CreatePersonalAccessToken :one
+insert into personal_access_tokens(user_id, name, token_hash, scopes, expires_at)
+values ($1, $2, $3, $4, $5)
+returning *;
+
+-- name: UsePersonalAccessToken :one
+update personal_access_tokens
+set last_used_at = current_timestamp
+where token_hash = $1
+	and revoked_at is null
+	and (expires_at is null or expires_at > current_timestamp)
+returning *;
+
+-- name: GetPersonalAccessTokensByUserID :many
+select * from personal_access_tokens
+where user_id = $1 and revoked_at is null
+order by created_at desc;
+
+-- name: RevokePersonalAccessToken :execrows
+update personal_access_tokens
+set revoked_at = current_timestamp
+where id = $1 and user_id = $2 and revoked_at is null;
+
+-- name: RevokeAllPersonalAccessTokensByUserID :exec
+update personal_access_tokens
+set revoked_at = current_timestamp
+where user_id = $1 and revoked_at is null;
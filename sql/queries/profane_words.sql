@@ -0,0 +1,12 @@
+-- name: GetProfaneWords :many
+select * from profane_words
+order by word;
+
+-- name: AddProfaneWord :exec
+insert into profane_words(word)
+values ($1)
+on conflict (word) do nothing;
+
+-- name: DeleteProfaneWord :execrows
+delete from profane_words
+where word = $1;
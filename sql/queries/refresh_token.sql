@@ -1,13 +1,51 @@
 -- name: CreateRefreshToken :one
-insert into refresh_tokens(token, user_id, expires_at)
-values ($1, $2, $3)
+insert into refresh_tokens(token, user_id, expires_at, family_id, user_agent, ip_address, client_id, scopes)
+values ($1, $2, $3, $4, $5, $6, $7, $8)
 returning *;
 
 -- name: GetRefreshToken :one
 select * from refresh_tokens
 where token = $1 and revoked_at is null;
 
--- name: RevokeToken :exec
+-- name: GetRefreshTokenIncludingRevoked :one
+select * from refresh_tokens
+where token = $1;
+
+-- name: ConsumeRefreshToken :one
+-- Tokens issued to an OAuth client can only be refreshed by that client, first party
+-- tokens have no client.
 update refresh_tokens
 set revoked_at = current_timestamp, updated_at = current_timestamp
-where token = $1 and revoked_at is null;
+where token = $1
+	and client_id is not distinct from sqlc.narg(client_id)
+	and revoked_at is null
+	and expires_at > current_timestamp
+returning *;
+
+-- name: RevokeToken :one
+update refresh_tokens
+set revoked_at = current_timestamp, updated_at = current_timestamp
+where token = $1 and revoked_at is null
+returning *;
+
+-- name: RevokeRefreshTokenFamily :execrows
+update refresh_tokens
+set revoked_at = current_timestamp, updated_at = current_timestamp
+where family_id = $1 and user_id = $2 and revoked_at is null;
+
+-- name: RevokeAllRefreshTokensByUserID :exec
+update refresh_tokens
+set revoked_at = current_timestamp, updated_at = current_timestamp
+where user_id = $1 and revoked_at is null;
+
+-- name: GetActiveSessionsByUserID :many
+select
+	rt.family_id,
+	rt.expires_at,
+	rt.last_used_at,
+	rt.user_agent,
+	rt.ip_address,
+	(select min(f.created_at) from refresh_tokens f where f.family_id = rt.family_id)::timestamp as created_at
+from refresh_tokens rt
+where rt.user_id = $1 and rt.revoked_at is null and rt.expires_at > current_timestamp
+order by rt.last_used_at desc;
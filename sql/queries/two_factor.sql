@@ -0,0 +1,36 @@
+-- name: SetUserPendingTOTPSecret :exec
+update users
+set totp_secret = $2, totp_enabled_at = null, updated_at = current_timestamp
+where id = $1;
+
+-- name: EnableUserTOTP :exec
+update users
+set totp_enabled_at = current_timestamp, totp_last_used_step = $2, updated_at = current_timestamp
+where id = $1 and totp_secret is not null;
+
+-- name: DisableUserTOTP :exec
+update users
+set totp_secret = null, totp_enabled_at = null, totp_last_used_step = 0, updated_at = current_timestamp
+where id = $1;
+
+-- name: UseTOTPStep :execrows
+update users
+set totp_last_used_step = $2
+where id = $1 and totp_last_used_step < $2;
+
+-- name: CreateRecoveryCode :exec
+insert into recovery_codes(user_id, code_hash)
+values ($1, $2);
+
+-- name: GetUnusedRecoveryCodesByUserID :many
+select * from recovery_codes
+where user_id = $1 and used_at is null;
+
+-- name: UseRecoveryCode :execrows
+update recovery_codes
+set used_at = current_timestamp
+where id = $1 and used_at is null;
+
+-- name: DeleteRecoveryCodesByUserID :exec
+delete from recovery_codes
+where user_id = $1;
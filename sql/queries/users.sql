@@ -7,11 +7,24 @@ returning *;
 select * from users
 where email = $1;
 
+-- name: GetUserById :one
+select * from users
+where id = $1;
+
 -- name: UpdateUserById :exec
 update users
-set hashed_password = $2, email = $3, updated_at = current_timestamp
+set
+	hashed_password = $2,
+	email = $3,
+	email_verified_at = case when email = $3 then email_verified_at else null end,
+	updated_at = current_timestamp
 where id = $1;
 
+-- name: VerifyUserEmail :execrows
+update users
+set email_verified_at = current_timestamp, updated_at = current_timestamp
+where id = $1 and email = $2;
+
 -- name: UpgradeUserToChirpyRed :exec
 update users
 set is_chirpy_red = true, updated_at = current_timestamp
@@ -19,3 +32,44 @@ where id = $1;
 
 -- name: DeleteAllUsers :exec
 delete from users;
+
+-- name: UpdateUserPassword :exec
+update users
+set hashed_password = $2, updated_at = current_timestamp
+where id = $1;
+
+-- name: SetUserRoleByEmail :execrows
+update users
+set role = $2, updated_at = current_timestamp
+where email = $1;
+
+-- name: RequestUserDeletion :one
+update users
+set deletion_requested_at = current_timestamp, updated_at = current_timestamp
+where id = $1 and deletion_requested_at is null
+returning *;
+
+-- name: CancelUserDeletion :execrows
+update users
+set deletion_requested_at = null, updated_at = current_timestamp
+where id = $1 and deletion_requested_at is not null;
+
+-- name: DeleteUsersPendingDeletion :many
+-- Chirps with replies are tombstoned and detached from the account so the threads below
+-- them survive, the other chirps go with the account.
+with purged as (
+	select id from users
+	where deletion_requested_at < sqlc.arg(requested_before)::timestamp
+), tombstoned as (
+	update chirps
+	set body = '',
+		updated_at = current_timestamp,
+		deleted_at = coalesce(deleted_at, current_timestamp),
+		flagged_at = null,
+		user_id = null
+	where user_id in (select id from purged)
+		and exists (select 1 from chirps replies where replies.reply_to_id = chirps.id)
+)
+delete from users
+where id in (select id from purged)
+returning id;
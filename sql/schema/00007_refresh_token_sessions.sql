@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table refresh_tokens add user_agent text not null default '';
+alter table refresh_tokens add ip_address text not null default '';
+alter table refresh_tokens add last_used_at timestamp not null default current_timestamp;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table refresh_tokens drop column last_used_at;
+alter table refresh_tokens drop column ip_address;
+alter table refresh_tokens drop column user_agent;
+-- +goose StatementEnd
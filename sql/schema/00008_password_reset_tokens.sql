@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+create table password_reset_tokens(
+	token_hash text primary key not null,
+	created_at timestamp not null default current_timestamp,
+	user_id uuid not null references users(id) on delete cascade,
+	expires_at timestamp not null,
+	used_at timestamp default null
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table password_reset_tokens;
+-- +goose StatementEnd
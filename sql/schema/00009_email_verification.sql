@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table users add email_verified_at timestamp default null;
+-- Accounts created before verification existed are trusted as they are.
+update users set email_verified_at = created_at;
+create table email_verification_tokens(
+	token_hash text primary key not null,
+	created_at timestamp not null default current_timestamp,
+	user_id uuid not null references users(id) on delete cascade,
+	email text not null,
+	expires_at timestamp not null,
+	used_at timestamp default null
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table email_verification_tokens;
+alter table users drop column email_verified_at;
+-- +goose StatementEnd
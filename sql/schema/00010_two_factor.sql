@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table users add totp_secret text default null;
+alter table users add totp_enabled_at timestamp default null;
+alter table users add totp_last_used_step bigint not null default 0;
+create table recovery_codes(
+	id uuid primary key default gen_random_uuid(),
+	created_at timestamp not null default current_timestamp,
+	user_id uuid not null references users(id) on delete cascade,
+	code_hash text not null,
+	used_at timestamp default null
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table recovery_codes;
+alter table users drop column totp_last_used_step;
+alter table users drop column totp_enabled_at;
+alter table users drop column totp_secret;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+create table login_failures(
+	key text primary key not null,
+	failures integer not null default 0,
+	last_failure_at timestamp not null
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table login_failures;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table users add role text not null default 'user';
+alter table users add constraint users_role_check check (role in ('user', 'moderator', 'admin'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table users drop constraint users_role_check;
+alter table users drop column role;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+create table personal_access_tokens(
+	id uuid primary key default gen_random_uuid(),
+	created_at timestamp not null default current_timestamp,
+	user_id uuid not null references users(id) on delete cascade,
+	name text not null,
+	token_hash text not null,
+	scopes text[] not null,
+	expires_at timestamp default null,
+	last_used_at timestamp default null,
+	revoked_at timestamp default null,
+	unique (token_hash)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table personal_access_tokens;
+-- +goose StatementEnd
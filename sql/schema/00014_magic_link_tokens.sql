@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+create table magic_link_tokens(
+	token_hash text primary key not null,
+	created_at timestamp not null default current_timestamp,
+	user_id uuid not null references users(id) on delete cascade,
+	email text not null,
+	expires_at timestamp not null,
+	used_at timestamp default null
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table magic_link_tokens;
+-- +goose StatementEnd
@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+create table oauth_clients(
+	id uuid primary key default gen_random_uuid(),
+	created_at timestamp not null default current_timestamp,
+	name text not null,
+	-- Public clients such as mobile apps cannot keep a secret and rely on PKCE alone.
+	secret_hash text default null,
+	redirect_uris text[] not null,
+	scopes text[] not null
+);
+
+create table oauth_authorization_codes(
+	code_hash text primary key not null,
+	created_at timestamp not null default current_timestamp,
+	client_id uuid not null references oauth_clients(id) on delete cascade,
+	user_id uuid not null references users(id) on delete cascade,
+	redirect_uri text not null,
+	scopes text[] not null,
+	code_challenge text not null,
+	nonce text not null default '',
+	expires_at timestamp not null,
+	used_at timestamp default null
+);
+
+alter table refresh_tokens
+	add client_id uuid default null references oauth_clients(id) on delete cascade,
+	add scopes text[] not null default '{}';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table refresh_tokens
+	drop column scopes,
+	drop column client_id;
+drop table oauth_authorization_codes;
+drop table oauth_clients;
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+-- actor_id has no foreign key so the history outlives the account it describes.
+create table audit_events(
+	id uuid primary key default gen_random_uuid(),
+	created_at timestamp not null default current_timestamp,
+	actor_id uuid default null,
+	action text not null,
+	target text not null default '',
+	ip_address text not null default '',
+	user_agent text not null default '',
+	outcome text not null check (outcome in ('success', 'failure'))
+);
+
+create index audit_events_actor_id_idx on audit_events(actor_id, created_at desc);
+create index audit_events_created_at_idx on audit_events(created_at desc);
+
+create function audit_events_append_only() returns trigger as $$
+begin
+	raise exception 'audit_events is append-only';
+end;
+$$ language plpgsql;
+
+create trigger audit_events_append_only
+before update or delete on audit_events
+for each row execute function audit_events_append_only();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop trigger audit_events_append_only on audit_events;
+drop function audit_events_append_only;
+drop table audit_events;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Accounts are purged once the grace period after deletion_requested_at is over, every
+-- table referencing users cascades so nothing is left behind but the audit events.
+alter table users add deletion_requested_at timestamp default null;
+create index users_deletion_requested_at_idx on users(deletion_requested_at) where deletion_requested_at is not null;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index users_deletion_requested_at_idx;
+alter table users drop column deletion_requested_at;
+-- +goose StatementEnd
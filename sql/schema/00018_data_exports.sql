@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+create table data_exports(
+	id uuid primary key default gen_random_uuid(),
+	created_at timestamp not null default current_timestamp,
+	updated_at timestamp not null default current_timestamp,
+	user_id uuid not null references users(id) on delete cascade,
+	status text not null default 'pending' check (status in ('pending', 'completed', 'failed')),
+	file_path text not null default '',
+	error text not null default '',
+	expires_at timestamp default null
+);
+
+-- A user can only have one export being assembled at a time.
+create unique index data_exports_pending_user_id_idx on data_exports(user_id) where status = 'pending';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table data_exports;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- external_id is the id a chirp had in the system it was imported from.
+alter table chirps add external_id text default null;
+create unique index chirps_user_id_external_id_idx on chirps(user_id, external_id) where external_id is not null;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index chirps_user_id_external_id_idx;
+alter table chirps drop column external_id;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+create table profane_words(
+	word text primary key,
+	created_at timestamp not null default current_timestamp
+);
+
+insert into profane_words(word) values ('kerfuffle'), ('sharbert'), ('fornax');
+
+-- flagged_at is set when the profanity filter flags a chirp for moderation.
+alter table chirps add flagged_at timestamp default null;
+create index chirps_flagged_at_idx on chirps(flagged_at) where flagged_at is not null;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index chirps_flagged_at_idx;
+alter table chirps drop column flagged_at;
+drop table profane_words;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Keyset pagination walks chirps by (created_at, id) in both directions.
+create index chirps_created_at_id_idx on chirps(created_at, id);
+create index chirps_user_id_created_at_id_idx on chirps(user_id, created_at, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index chirps_user_id_created_at_id_idx;
+drop index chirps_created_at_id_idx;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- search_vector is kept in sync by postgres, the english config stems words and drops stop words.
+alter table chirps add search_vector tsvector
+	generated always as (to_tsvector('english', body)) stored;
+create index chirps_search_vector_idx on chirps using gin(search_vector);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index chirps_search_vector_idx;
+alter table chirps drop column search_vector;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- edited_at is set on every edit, the replaced bodies are kept in chirp_revisions.
+alter table chirps add edited_at timestamp default null;
+
+create table chirp_revisions(
+	id uuid primary key default gen_random_uuid(),
+	-- created_at is when the body was published, replaced_at when an edit replaced it.
+	created_at timestamp not null,
+	replaced_at timestamp not null default current_timestamp,
+	chirp_id uuid not null references chirps(id) on delete cascade,
+	body text not null
+);
+create index chirp_revisions_chirp_id_idx on chirp_revisions(chirp_id, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table chirp_revisions;
+alter table chirps drop column edited_at;
+-- +goose StatementEnd
@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Deleting a chirp with replies turns it into a tombstone (deleted_at set, body cleared) so
+-- threads stay whole. Purged accounts still remove their chirps, replies then lose their parent.
+alter table chirps add reply_to_id uuid default null references chirps(id) on delete set null;
+alter table chirps add reply_count integer not null default 0;
+alter table chirps add deleted_at timestamp default null;
+create index chirps_reply_to_id_idx on chirps(reply_to_id, created_at, id) where reply_to_id is not null;
+
+-- reply_count only counts replies that are not tombstones.
+create function chirps_reply_count() returns trigger as $$
+begin
+	if tg_op in ('UPDATE', 'DELETE') and old.reply_to_id is not null and old.deleted_at is null then
+		update chirps set reply_count = reply_count - 1 where id = old.reply_to_id;
+	end if;
+	if tg_op in ('INSERT', 'UPDATE') and new.reply_to_id is not null and new.deleted_at is null then
+		update chirps set reply_count = reply_count + 1 where id = new.reply_to_id;
+	end if;
+	return null;
+end;
+$$ language plpgsql;
+
+create trigger chirps_reply_count
+after insert or delete or update of reply_to_id, deleted_at on chirps
+for each row execute function chirps_reply_count();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop trigger chirps_reply_count on chirps;
+drop function chirps_reply_count;
+delete from chirps where deleted_at is not null;
+drop index chirps_reply_to_id_idx;
+alter table chirps drop column deleted_at;
+alter table chirps drop column reply_count;
+alter table chirps drop column reply_to_id;
+-- +goose StatementEnd
@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+create table chirp_likes(
+	user_id uuid not null references users(id) on delete cascade,
+	chirp_id uuid not null references chirps(id) on delete cascade,
+	created_at timestamp not null default current_timestamp,
+	primary key (user_id, chirp_id)
+);
+create index chirp_likes_chirp_id_idx on chirp_likes(chirp_id, created_at, user_id);
+
+-- like_count saves counting chirp_likes every time a chirp is read.
+alter table chirps add like_count integer not null default 0;
+
+create function chirps_like_count() returns trigger as $$
+begin
+	if tg_op = 'INSERT' then
+		update chirps set like_count = like_count + 1 where id = new.chirp_id;
+	else
+		update chirps set like_count = like_count - 1 where id = old.chirp_id;
+	end if;
+	return null;
+end;
+$$ language plpgsql;
+
+create trigger chirps_like_count
+after insert or delete on chirp_likes
+for each row execute function chirps_like_count();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop trigger chirps_like_count on chirp_likes;
+drop function chirps_like_count;
+alter table chirps drop column like_count;
+drop table chirp_likes;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Purging an account keeps its chirps that have replies as tombstones without an author,
+-- the replies below them stay in their thread instead of becoming roots.
+alter table chirps alter column user_id drop not null;
+alter table chirps add constraint chirps_author_check check (user_id is not null or deleted_at is not null);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+delete from chirps where user_id is null;
+alter table chirps drop constraint chirps_author_check;
+alter table chirps alter column user_id set not null;
+-- +goose StatementEnd
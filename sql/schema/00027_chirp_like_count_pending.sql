@@ -0,0 +1,59 @@
+-- +goose Up
+-- +goose StatementBegin
+-- like_count leaves out likes of accounts pending deletion like the list of likes does,
+-- requesting or cancelling a deletion moves the account's likes out of or back into the counts.
+create or replace function chirps_like_count() returns trigger as $$
+begin
+	if tg_op = 'INSERT' then
+		update chirps set like_count = like_count + 1 where id = new.chirp_id
+			and exists (select 1 from users where id = new.user_id and deletion_requested_at is null);
+	else
+		-- Purged accounts are gone by the time their likes cascade, they were not counted anymore.
+		update chirps set like_count = like_count - 1 where id = old.chirp_id
+			and exists (select 1 from users where id = old.user_id and deletion_requested_at is null);
+	end if;
+	return null;
+end;
+$$ language plpgsql;
+
+create function users_like_count() returns trigger as $$
+begin
+	update chirps
+	set like_count = like_count + case when new.deletion_requested_at is null then 1 else -1 end
+	where id in (select chirp_id from chirp_likes where user_id = new.id);
+	return null;
+end;
+$$ language plpgsql;
+
+create trigger users_like_count
+after update of deletion_requested_at on users
+for each row when ((old.deletion_requested_at is null) != (new.deletion_requested_at is null))
+execute function users_like_count();
+
+update chirps
+set like_count = (
+	select count(*) from chirp_likes
+	join users on users.id = chirp_likes.user_id
+	where chirp_likes.chirp_id = chirps.id and users.deletion_requested_at is null
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop trigger users_like_count on users;
+drop function users_like_count;
+
+create or replace function chirps_like_count() returns trigger as $$
+begin
+	if tg_op = 'INSERT' then
+		update chirps set like_count = like_count + 1 where id = new.chirp_id;
+	else
+		update chirps set like_count = like_count - 1 where id = old.chirp_id;
+	end if;
+	return null;
+end;
+$$ language plpgsql;
+
+update chirps
+set like_count = (select count(*) from chirp_likes where chirp_likes.chirp_id = chirps.id);
+-- +goose StatementEnd
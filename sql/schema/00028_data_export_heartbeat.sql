@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The process assembling an export touches heartbeat_at while it works on it, a
+-- pending export whose heartbeat went quiet was left behind by a process that died.
+alter table data_exports add column heartbeat_at timestamp not null default current_timestamp;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table data_exports drop column heartbeat_at;
+-- +goose StatementEnd
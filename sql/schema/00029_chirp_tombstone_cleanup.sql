@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A tombstone only stands for its replies, it goes away with the last of them whether its
+-- author is still around or was purged. Removing it may in turn empty its own parent.
+create function chirps_remove_tombstone() returns trigger as $$
+begin
+	delete from chirps
+	where id = old.reply_to_id and deleted_at is not null
+		and not exists (select 1 from chirps replies where replies.reply_to_id = old.reply_to_id);
+	return null;
+end;
+$$ language plpgsql;
+
+create trigger chirps_remove_tombstone
+after delete on chirps
+for each row when (old.reply_to_id is not null)
+execute function chirps_remove_tombstone();
+
+delete from chirps
+where deleted_at is not null
+	and not exists (select 1 from chirps replies where replies.reply_to_id = chirps.id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop trigger chirps_remove_tombstone on chirps;
+drop function chirps_remove_tombstone;
+-- +goose StatementEnd